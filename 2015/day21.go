@@ -1,127 +1,323 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+var shopFile = flag.String("shop", "", "File listing the shop's items; the puzzle's shop if empty.")
+var bossFile = flag.String("boss", "", "File with the boss's stats; read from standard input if empty.")
+var hitpoints = flag.Int("hitpoints", 100, "The player's hit points.")
+var pareto = flag.Bool("pareto", false, "Print the Pareto frontier of cost against how comfortably each loadout wins or loses.")
+
 type Entity struct {
 	Hitpoints, Damage, Defense int
 }
 
-type Weapon struct {
-	Cost, Damage int
+type Item struct {
+	Name                  string
+	Cost, Damage, Defense int
 }
 
-type Armor struct {
-	Cost, Defense int
+// Category is a section of the shop, of which the player buys between Min
+// and Max different items.
+type Category struct {
+	Name     string
+	Min, Max int
+	Items    []Item
 }
 
-type Ring struct {
-	Cost, Damage, Defense int
+// limits are how many of each of the puzzle's categories the player may
+// buy, for shops that don't say.
+var limits = map[string][2]int{
+	"Weapons": {1, 1},
+	"Armor":   {0, 1},
+	"Rings":   {0, 2},
 }
 
-type EquipmentSet struct {
-	Wielded             Weapon
-	Worn                Armor
-	LeftRing, RightRing Ring
+const defaultShop = `Weapons:    Cost  Damage  Armor
+Dagger        8     4       0
+Shortsword   10     5       0
+Warhammer    25     6       0
+Longsword    40     7       0
+Greataxe     74     8       0
+
+Armor:      Cost  Damage  Armor
+Leather      13     0       1
+Chainmail    31     0       2
+Splintmail   53     0       3
+Bandedmail   75     0       4
+Platemail   102     0       5
+
+Rings:      Cost  Damage  Armor
+Damage +1    25     1       0
+Damage +2    50     2       0
+Damage +3   100     3       0
+Defense +1   20     0       1
+Defense +2   40     0       2
+Defense +3   80     0       3
+`
+
+var headerRE = regexp.MustCompile(`^([A-Za-z]+)(?: \(([0-9]+)-([0-9]+)\))?:`)
+
+// ParseShop reads a shop in the format of the puzzle text: a header line
+// per category, followed by one item per line ending in its cost, damage
+// and armor. A header may give how many of its items the player buys, as
+// in "Shields (0-1):"; otherwise the category must be one of the puzzle's.
+func ParseShop(in io.Reader) ([]Category, error) {
+	var shop []Category
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if m := headerRE.FindStringSubmatch(text); m != nil {
+			c := Category{Name: m[1]}
+			if m[2] != "" {
+				c.Min, _ = strconv.Atoi(m[2])
+				c.Max, _ = strconv.Atoi(m[3])
+				if c.Min > c.Max {
+					return nil, fmt.Errorf("line %d: %s has minimum %d above maximum %d", line, c.Name, c.Min, c.Max)
+				}
+			} else if lim, ok := limits[c.Name]; ok {
+				c.Min, c.Max = lim[0], lim[1]
+			} else {
+				return nil, fmt.Errorf("line %d: category %q needs limits, as in \"%s (0-1):\"", line, c.Name, c.Name)
+			}
+			shop = append(shop, c)
+			continue
+		}
+		if len(shop) == 0 {
+			return nil, fmt.Errorf("line %d: item before any category", line)
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected name, cost, damage and armor", line)
+		}
+		n := len(fields)
+		var stats [3]int
+		for i := range stats {
+			v, err := strconv.Atoi(fields[n-3+i])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			stats[i] = v
+		}
+		c := &shop[len(shop)-1]
+		c.Items = append(c.Items, Item{strings.Join(fields[:n-3], " "), stats[0], stats[1], stats[2]})
+	}
+	return shop, scanner.Err()
 }
 
-func (e *Entity) AttackOnce(target *Entity) bool {
-	hit := e.Damage - target.Defense
-	if hit < 1 {
-		hit = 1
+// ParseBoss reads the boss's stats, as given in the puzzle input.
+func ParseBoss(in io.Reader) (Entity, error) {
+	var boss Entity
+	fields := map[string]*int{
+		"Hit Points": &boss.Hitpoints,
+		"Damage":     &boss.Damage,
+		"Armor":      &boss.Defense,
+	}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		field, ok := fields[parts[0]]
+		if len(parts) != 2 || !ok {
+			return boss, fmt.Errorf("line %d: expected one of Hit Points, Damage or Armor, got %q", line, text)
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return boss, fmt.Errorf("line %d: %v", line, err)
+		}
+		*field = v
+		seen[parts[0]] = true
 	}
-	target.Hitpoints -= hit
-	if target.Hitpoints <= 0 {
-		return true
+	if err := scanner.Err(); err != nil {
+		return boss, err
 	}
-	return false
+	for name := range fields {
+		if !seen[name] {
+			return boss, fmt.Errorf("missing %s", name)
+		}
+	}
+	return boss, nil
 }
 
-func (es EquipmentSet) TotalCost() int {
-	return es.Wielded.Cost + es.Worn.Cost + es.LeftRing.Cost + es.RightRing.Cost
+// Loadout is a set of items bought from the shop.
+type Loadout []Item
+
+func (l Loadout) Cost() int {
+	cost := 0
+	for _, it := range l {
+		cost += it.Cost
+	}
+	return cost
 }
 
-func (es EquipmentSet) GenerateEntity(startHealth int) Entity {
-	return Entity{
-		Hitpoints: startHealth,
-		Damage:    es.Wielded.Damage + es.LeftRing.Damage + es.RightRing.Damage,
-		Defense:   es.Worn.Defense + es.LeftRing.Defense + es.RightRing.Defense,
+func (l Loadout) Entity(hitpoints int) Entity {
+	e := Entity{Hitpoints: hitpoints}
+	for _, it := range l {
+		e.Damage += it.Damage
+		e.Defense += it.Defense
 	}
+	return e
 }
 
-func Fight(player, boss Entity) bool {
-	for {
-		if player.AttackOnce(&boss) {
-			return true
+func (l Loadout) String() string {
+	names := make([]string, len(l))
+	for i, it := range l {
+		names[i] = it.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Loadouts returns every way of shopping within each category's limits.
+func Loadouts(shop []Category) []Loadout {
+	ret := []Loadout{nil}
+	for _, c := range shop {
+		var choices []Loadout
+		var choose func(from int, picked Loadout)
+		choose = func(from int, picked Loadout) {
+			if len(picked) >= c.Min {
+				choices = append(choices, append(Loadout(nil), picked...))
+			}
+			if len(picked) == c.Max {
+				return
+			}
+			for i := from; i < len(c.Items); i++ {
+				choose(i+1, append(picked, c.Items[i]))
+			}
 		}
-		if boss.AttackOnce(&player) {
-			return false
+		choose(0, nil)
+
+		var next []Loadout
+		for _, l := range ret {
+			for _, ch := range choices {
+				next = append(next, append(append(Loadout(nil), l...), ch...))
+			}
 		}
+		ret = next
 	}
+	return ret
+}
+
+// turnsToKill is how many attacks it takes attacker to bring down target.
+func turnsToKill(attacker, target Entity) int {
+	hit := attacker.Damage - target.Defense
+	if hit < 1 {
+		hit = 1
+	}
+	return (target.Hitpoints + hit - 1) / hit
+}
+
+// Margin is how many of the boss's attacks the player could still take
+// after landing the killing blow; it's negative if the player loses. The
+// player attacks first, so wins ties.
+func Margin(player, boss Entity) int {
+	return turnsToKill(boss, player) - turnsToKill(player, boss)
+}
+
+type Result struct {
+	Loadout Loadout
+	Cost    int
+	Margin  int
+}
+
+// Frontier returns the results no other result beats on both cost and
+// margin, for winners (cheaper is better, and a bigger margin) and losers
+// (dearer is better, and a smaller margin), ordered from the best cost.
+func Frontier(results []Result) (wins, losses []Result) {
+	sorted := append([]Result(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Cost != sorted[j].Cost {
+			return sorted[i].Cost < sorted[j].Cost
+		}
+		return sorted[i].Margin > sorted[j].Margin
+	})
+	for _, r := range sorted {
+		if r.Margin >= 0 && (len(wins) == 0 || r.Margin > wins[len(wins)-1].Margin) {
+			wins = append(wins, r)
+		}
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		r := sorted[i]
+		if r.Margin < 0 && (len(losses) == 0 || r.Margin < losses[len(losses)-1].Margin) {
+			losses = append(losses, r)
+		}
+	}
+	return wins, losses
 }
 
 func main() {
-	allArmor := []Armor{
-		{0, 0},
-		{13, 1},
-		{31, 2},
-		{53, 3},
-		{75, 4},
-		{102, 5},
-	}
-	allWeapons := []Weapon{
-		{8, 4},
-		{10, 5},
-		{25, 6},
-		{40, 7},
-		{74, 8},
-	}
-	allRings := []Ring{
-		{0, 0, 0},
-		{0, 0, 0},
-		{25, 1, 0},
-		{50, 2, 0},
-		{100, 3, 0},
-		{20, 0, 1},
-		{40, 0, 2},
-		{80, 0, 3},
-	}
-
-	boss := Entity{
-		Hitpoints: 109,
-		Damage:    8,
-		Defense:   2,
-	}
-
-	cheapest := 9999999
-	expensivest := 0
-
-	for w := range allWeapons {
-		for a := range allArmor {
-			for lr := range allRings {
-				for rr := range allRings {
-					if rr >= lr {
-						// Don't allow buying the same ring twice; treat rings as symmetric.
-						continue
-					}
-					es := EquipmentSet{
-						Wielded:   allWeapons[w],
-						Worn:      allArmor[a],
-						LeftRing:  allRings[lr],
-						RightRing: allRings[rr],
-					}
-					cost := es.TotalCost()
-					player := es.GenerateEntity(100)
-					if Fight(player, boss) && cost < cheapest {
-						cheapest = cost
-					}
-					if !Fight(player, boss) && cost > expensivest {
-						expensivest = cost
-					}
-				}
-			}
+	flag.Parse()
+
+	shopIn := io.Reader(strings.NewReader(defaultShop))
+	if *shopFile != "" {
+		f, err := os.Open(*shopFile)
+		if err != nil {
+			fmt.Printf("Could not open file %s because %v.\n", *shopFile, err)
+			return
+		}
+		defer f.Close()
+		shopIn = f
+	}
+	shop, err := ParseShop(shopIn)
+	if err != nil {
+		fmt.Printf("Failed to parse shop: %v\n", err)
+		return
+	}
+
+	bossIn := io.Reader(os.Stdin)
+	if *bossFile != "" {
+		f, err := os.Open(*bossFile)
+		if err != nil {
+			fmt.Printf("Could not open file %s because %v.\n", *bossFile, err)
+			return
 		}
+		defer f.Close()
+		bossIn = f
+	}
+	boss, err := ParseBoss(bossIn)
+	if err != nil {
+		fmt.Printf("Failed to parse boss: %v\n", err)
+		return
+	}
+
+	var results []Result
+	for _, l := range Loadouts(shop) {
+		results = append(results, Result{l, l.Cost(), Margin(l.Entity(*hitpoints), boss)})
+	}
+	wins, losses := Frontier(results)
+
+	cheapest, expensivest := -1, -1
+	if len(wins) > 0 {
+		cheapest = wins[0].Cost
+	}
+	if len(losses) > 0 {
+		expensivest = losses[0].Cost
 	}
 	fmt.Println(cheapest, expensivest)
+
+	if *pareto {
+		fmt.Println("Winning:")
+		for _, r := range wins {
+			fmt.Printf("  %4d gold, %3d turns to spare: %v\n", r.Cost, r.Margin, r.Loadout)
+		}
+		fmt.Println("Losing:")
+		for _, r := range losses {
+			fmt.Printf("  %4d gold, %3d turns short: %v\n", r.Cost, -r.Margin, r.Loadout)
+		}
+	}
 }
@@ -1,226 +1,290 @@
 package main
 
 import (
+	"container/heap"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"math"
+	"io/ioutil"
+	"strings"
 )
 
-var parallelize = true
-var hard = true
-var recursionDepth = 13
-var verbose = false
+var configFile = flag.String("config", "", "JSON file describing the player, boss and spells; the puzzle's if empty.")
+var hard = flag.Bool("hard", false, "Part B: the player loses a hit point at the start of each of their turns.")
+var verbose = flag.Bool("verbose", false, "Replay the winning fight turn by turn.")
 
-type Entity struct {
-	Hitpoints, Damage, Defense, Mana int
-	Effects                          []Effect
+// Spell is anything the player can cast. A spell with Turns of 0 takes
+// effect once, immediately; otherwise it starts an effect that applies at
+// the start of each of the next Turns turns, while Armor lasts throughout.
+type Spell struct {
+	Name   string
+	Cost   int
+	Turns  int
+	Damage int
+	Heal   int
+	Mana   int
+	Armor  int
 }
 
-var boss = Entity{
-	Hitpoints: 71,
-	Damage:    10,
-	Defense:   0,
-	Mana:      0,
+type Player struct {
+	Hitpoints, Mana, Armor int
 }
 
-var player = Entity{
-	Hitpoints: 50,
-	Damage:    0,
-	Defense:   0,
-	Mana:      500,
+type Boss struct {
+	Hitpoints, Damage int
 }
 
-type Effect struct {
-	Name      string
-	TurnsLeft int
-	Mana      int
-	Armor     int
-	Damage    int
+type Config struct {
+	Hard   bool
+	Player Player
+	Boss   Boss
+	Spells []Spell
 }
 
-type Spell struct {
-	Cost   int
-	Self   Effect
-	Target Effect
-}
+const defaultConfig = `{
+	"Player": {"Hitpoints": 50, "Mana": 500},
+	"Boss": {"Hitpoints": 71, "Damage": 10},
+	"Spells": [
+		{"Name": "Magic Missile", "Cost": 53, "Damage": 4},
+		{"Name": "Drain", "Cost": 73, "Damage": 2, "Heal": 2},
+		{"Name": "Shield", "Cost": 113, "Turns": 6, "Armor": 7},
+		{"Name": "Poison", "Cost": 173, "Turns": 6, "Damage": 3},
+		{"Name": "Recharge", "Cost": 229, "Turns": 5, "Mana": 101}
+	]
+}`
 
+// State is the fight at the start of one of the player's turns. Timers
+// holds, for each spell, the turns its effect has left; it's a string so
+// that State can be a map key.
 type State struct {
-	Player, Boss Entity
-	ManaSpent    int
-}
-
-func (ent *Entity) ApplyEffects() {
-	newEffects := make([]Effect, 0, len(ent.Effects))
-	for i := range ent.Effects {
-		eff := ent.Effects[i]
-		ent.Mana += eff.Mana
-		ent.Hitpoints += eff.Damage
-		eff.TurnsLeft--
-		if eff.TurnsLeft != 0 {
-			newEffects = append(newEffects, eff)
-		} else {
-			ent.Defense -= eff.Armor
-		}
-	}
-	ent.Effects = newEffects
+	PlayerHP, Mana, BossHP int
+	Timers                 string
 }
-func (s *Spell) CastSpell(player, target *Entity) bool {
-	if s.Cost > player.Mana {
-		return false
-	}
-	for i := range player.Effects {
-		if player.Effects[i].Name == s.Self.Name {
-			return false
-		}
-	}
-	for i := range target.Effects {
-		if target.Effects[i].Name == s.Target.Name {
-			return false
-		}
-	}
 
-	player.Mana -= s.Cost
+// Outcome of a move.
+const (
+	Ongoing = iota
+	Won
+	Lost
+)
 
-	// Armor instantaneously applies, and will be removed by the timer.
-	player.Defense += s.Self.Armor
-	if s.Self.TurnsLeft > 0 {
-		player.Effects = append(player.Effects, s.Self)
-	}
-	if s.Target.TurnsLeft > 0 {
-		target.Effects = append(target.Effects, s.Target)
-	}
-	return true
+// Fight is a configured battle.
+type Fight struct {
+	Config
+	log func(format string, args ...interface{})
 }
 
-func (e *Entity) AttackOnce(target *Entity) bool {
-	hit := e.Damage - target.Defense
-	if hit < 1 {
-		hit = 1
-	}
-	target.Hitpoints -= hit
-	if target.Hitpoints <= 0 {
-		return true
+func (f *Fight) logf(format string, args ...interface{}) {
+	if f.log != nil {
+		f.log(format, args...)
 	}
-	return false
 }
 
-func FightIncremental(state State, spell Spell) (bool, bool, bool, State) {
-	if hard {
-		state.Player.Hitpoints--
-		if state.Player.Hitpoints <= 0 {
-			return false, false, true, state
+func (f *Fight) Start() State {
+	return State{f.Player.Hitpoints, f.Player.Mana, f.Boss.Hitpoints, strings.Repeat("\x00", len(f.Spells))}
+}
+
+// applyEffects runs every active effect once, returning the timers after
+// ticking and the player's armor while they applied.
+func (f *Fight) applyEffects(s *State) int {
+	timers := []byte(s.Timers)
+	armor := f.Player.Armor
+	for i, left := range timers {
+		if left == 0 {
+			continue
 		}
+		sp := f.Spells[i]
+		s.BossHP -= sp.Damage
+		s.PlayerHP += sp.Heal
+		s.Mana += sp.Mana
+		armor += sp.Armor
+		timers[i]--
+		f.logf("%s's effect applies; its timer is now %d.\n", sp.Name, timers[i])
 	}
+	s.Timers = string(timers)
+	return armor
+}
 
-	state.Player.ApplyEffects()
-	state.Boss.ApplyEffects()
-
-	if !spell.CastSpell(&state.Player, &state.Boss) {
-		return false, false, false, state
+// startTurn runs the start of the player's turn, before they cast.
+func (f *Fight) startTurn(s State) (State, int) {
+	f.logf("-- Player turn: %d hit points, %d mana; boss has %d hit points\n", s.PlayerHP, s.Mana, s.BossHP)
+	if f.Hard {
+		s.PlayerHP--
+		if s.PlayerHP <= 0 {
+			return s, Lost
+		}
+	}
+	f.applyEffects(&s)
+	if s.BossHP <= 0 {
+		return s, Won
 	}
-	state.ManaSpent += spell.Cost
+	return s, Ongoing
+}
 
-	state.Player.ApplyEffects()
-	state.Boss.ApplyEffects()
+// Move plays the player casting spell i and the boss's reply. It returns
+// false if the spell can't be cast.
+func (f *Fight) Move(s State, i int) (State, int, bool) {
+	s, outcome := f.startTurn(s)
+	if outcome != Ongoing {
+		return s, outcome, true
+	}
+	return f.cast(s, i)
+}
 
-	if state.Boss.Hitpoints <= 0 {
-		// Win!
-		return true, false, true, state
+// cast plays the rest of a turn from after startTurn.
+func (f *Fight) cast(s State, i int) (State, int, bool) {
+	sp := f.Spells[i]
+	if sp.Cost > s.Mana || s.Timers[i] != 0 {
+		return s, Ongoing, false
 	}
-	if state.Boss.AttackOnce(&state.Player) {
-		// Loss!
-		return false, false, true, state
+	f.logf("Player casts %s.\n", sp.Name)
+	s.Mana -= sp.Cost
+	if sp.Turns == 0 {
+		s.BossHP -= sp.Damage
+		s.PlayerHP += sp.Heal
+		s.Mana += sp.Mana
+	} else {
+		timers := []byte(s.Timers)
+		timers[i] = byte(sp.Turns)
+		s.Timers = string(timers)
+	}
+	if s.BossHP <= 0 {
+		return s, Won, true
 	}
 
-	return false, true, true, state
+	f.logf("-- Boss turn: %d hit points, %d mana; boss has %d hit points\n", s.PlayerHP, s.Mana, s.BossHP)
+	armor := f.applyEffects(&s)
+	if s.BossHP <= 0 {
+		return s, Won, true
+	}
+	hit := f.Boss.Damage - armor
+	if hit < 1 {
+		hit = 1
+	}
+	s.PlayerHP -= hit
+	f.logf("Boss attacks for %d damage.\n", hit)
+	if s.PlayerHP <= 0 {
+		return s, Lost, true
+	}
+	return s, Ongoing, true
 }
 
-var allSpells = []Spell{
-	{53, Effect{}, Effect{"MM", 1, 0, 0, -4}},
-	{73, Effect{"Drain", 1, 0, 0, 2}, Effect{"Drain", 1, 0, 0, -2}},
-	{113, Effect{"Shield", 6, 0, 7, 0}, Effect{}},
-	{173, Effect{}, Effect{"Poison", 6, 0, 0, -3}},
-	{229, Effect{"Recharge", 5, 101, 0, 0}, Effect{}},
+type queued struct {
+	state State
+	spent int
 }
 
-func main() {
-	leastManaSpent := TestSpells([]Spell{}, State{player, boss, 0}, recursionDepth)
-	fmt.Println(leastManaSpent)
+type queue []queued
+
+func (q queue) Len() int            { return len(q) }
+func (q queue) Less(i, j int) bool  { return q[i].spent < q[j].spent }
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(queued)) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
 }
 
-func TestSpells(prev []Spell, os State, depth int) int {
-	values := make(chan int, len(allSpells))
+type step struct {
+	from  State
+	spell int
+}
 
-	for s := range allSpells {
-		if allSpells[s].Cost > 100 {
-			lookBack := 2
-			i := len(prev) - lookBack
-			if i < 0 {
-				i = 0
-			}
-			for ; i < len(prev); i++ {
-				if allSpells[s].Cost == prev[i].Cost {
-					// Save fan-out.
-					continue
-				}
+// Cheapest finds the least mana that wins the fight with Dijkstra's
+// algorithm, where each edge is a spell weighted by its cost. It returns
+// the spells cast, or false if the fight can't be won.
+func (f *Fight) Cheapest() (int, []int, bool) {
+	start := f.Start()
+	best := map[State]int{start: 0}
+	prev := make(map[State]step)
+	q := &queue{{start, 0}}
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(queued)
+		if cur.spent > best[cur.state] {
+			continue
+		}
+		turn, outcome := f.startTurn(cur.state)
+		if cur.state.BossHP <= 0 || outcome == Won {
+			var spells []int
+			for s := cur.state; s != start; s = prev[s].from {
+				spells = append([]int{prev[s].spell}, spells...)
 			}
+			return cur.spent, spells, true
 		}
-
-		compute := func(previous []Spell, oldState State, maxDepth, spell int) {
-			spellList := make([]Spell, len(previous)+1)
-			copy(spellList[:len(previous)], previous)
-			spellList[len(previous)] = allSpells[spell]
-
-			// win, proceed, state := Fight(player, boss, spellList)
-			win, proceed, valid, state := FightIncremental(oldState, allSpells[spell])
-
-			finalState := state
-			finalState.Player.ApplyEffects()
-			finalState.Boss.ApplyEffects()
-
-			// Part (b)
-			if hard {
-				finalState.Player.Hitpoints--
-				if finalState.Boss.Hitpoints <= 0 && finalState.Player.Hitpoints > 0 && valid {
-					win = true
-				}
-			} else {
-				if finalState.Boss.Hitpoints <= 0 && valid {
-					win = true
-				}
+		if outcome == Lost {
+			continue
+		}
+		for i, sp := range f.Spells {
+			next, outcome, ok := f.cast(turn, i)
+			if !ok || outcome == Lost {
+				continue
 			}
-
-			if win {
-				if verbose {
-					fmt.Printf("%d mana spent: ", finalState.ManaSpent)
-					for i := range spellList {
-						fmt.Printf("%d, ", spellList[i].Cost)
-					}
-					fmt.Printf("\n")
-				}
-				values <- finalState.ManaSpent
-				// Definitionally our children will spend more mana.
-				return
+			if outcome == Won {
+				// Winning states only need to compare equal to each other.
+				next = State{BossHP: 0}
 			}
-
-			if maxDepth >= 1 && proceed {
-				values <- TestSpells(spellList, state, maxDepth-1)
-			} else {
-				values <- math.MaxInt32
+			spent := cur.spent + sp.Cost
+			if b, seen := best[next]; seen && b <= spent {
+				continue
 			}
+			best[next] = spent
+			prev[next] = step{cur.state, i}
+			heap.Push(q, queued{next, spent})
 		}
-		if depth == recursionDepth && parallelize {
-			go compute(prev, os, depth, s)
-		} else {
-			compute(prev, os, depth, s)
+	}
+	return 0, nil, false
+}
+
+func main() {
+	flag.Parse()
+
+	data := []byte(defaultConfig)
+	if *configFile != "" {
+		var err error
+		data, err = ioutil.ReadFile(*configFile)
+		if err != nil {
+			fmt.Printf("Could not open file %s because %v.\n", *configFile, err)
+			return
 		}
 	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		fmt.Printf("Failed to parse config: %v\n", err)
+		return
+	}
+	for _, sp := range cfg.Spells {
+		if sp.Turns > 255 {
+			fmt.Printf("Spell %s lasts too long: %d turns\n", sp.Name, sp.Turns)
+			return
+		}
+	}
+	cfg.Hard = cfg.Hard || *hard
+
+	f := &Fight{Config: cfg}
+	spent, spells, ok := f.Cheapest()
+	if !ok {
+		fmt.Println("The boss can't be beaten.")
+		return
+	}
+	names := make([]string, len(spells))
+	for i, sp := range spells {
+		names[i] = f.Spells[sp].Name
+	}
+	fmt.Println(spent)
+	fmt.Println(strings.Join(names, ", "))
 
-	leastManaSpent := math.MaxInt32
-	for i := 0; i < len(allSpells); i++ {
-		v := <-values
-		if v < leastManaSpent {
-			leastManaSpent = v
+	if *verbose {
+		f.log = func(format string, args ...interface{}) { fmt.Printf(format, args...) }
+		s := f.Start()
+		for _, sp := range spells {
+			s, _, _ = f.Move(s, sp)
+		}
+		if s.BossHP > 0 {
+			// The winning blow comes from effects at the start of the next turn.
+			s, _ = f.startTurn(s)
 		}
+		fmt.Println("The boss is dead.")
 	}
-	return leastManaSpent
 }
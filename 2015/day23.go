@@ -2,18 +2,24 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strconv"
 )
 
-var trace = false
+var inputFile = flag.String("inputFile", "", "File to read the program from; standard input if empty.")
+var initA = flag.Uint("a", 0, "Initial value of register a. Part B starts it at 1.")
+var initB = flag.Uint("b", 0, "Initial value of register b.")
+var trace = flag.Bool("trace", false, "Print out each instruction as it's being executed.")
 
 type Machine struct {
 	A, B               uint
 	InstructionPointer int
 	Instructions       []Instruction
+	Source             []string
 }
 
 type Instruction func(ip *int)
@@ -27,177 +33,138 @@ func (m *Machine) Execute() bool {
 	return true
 }
 
-func main() {
-	reader := bufio.NewReader(os.Stdin)
-	r := regexp.MustCompile("(hlf|tpl|inc|jmp|jie|jio) ([ab]|[+-][0-9]+)(?:, ([+-][0-9]+))?")
+var instructionRE = regexp.MustCompile(`^(hlf|tpl|inc|jmp|jie|jio) ([ab]|[+-][0-9]+)(?:, ([+-][0-9]+))?$`)
 
-	// Part (a)
-	// m := Machine{0, 0, 0, make([]Instruction, 0)}
-	// Part (b)
-	m := Machine{1, 0, 0, make([]Instruction, 0)}
+// register returns the register named by s.
+func (m *Machine) register(s string) (*uint, error) {
+	switch s {
+	case "a":
+		return &m.A, nil
+	case "b":
+		return &m.B, nil
+	}
+	return nil, fmt.Errorf("unrecognized register %q", s)
+}
 
-	for {
-		line, err := reader.ReadString('\n')
+// offset parses a signed jump offset such as +4 or -7.
+func offset(s string) (int, error) {
+	if s == "" || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("unrecognized jump offset %q", s)
+	}
+	return strconv.Atoi(s)
+}
+
+// compile turns one line of source into an instruction.
+func (m *Machine) compile(line string) (Instruction, error) {
+	result := instructionRE.FindStringSubmatch(line)
+	if result == nil {
+		return nil, fmt.Errorf("unrecognized instruction %q", line)
+	}
+	op, arg, jump := result[1], result[2], result[3]
+
+	switch op {
+	case "jmp":
+		if jump != "" {
+			return nil, fmt.Errorf("jmp takes one operand")
+		}
+		off, err := offset(arg)
 		if err != nil {
-			break
+			return nil, err
 		}
-		result := r.FindStringSubmatch(line)
-		switch result[1] {
-		case "hlf":
-			var reg *uint
-			if result[2] == "a" {
-				reg = &m.A
-			} else if result[2] == "b" {
-				reg = &m.B
-			} else {
-				fmt.Println("Unrecognized register")
-				continue
-			}
-			i := func(ip *int) {
-				*ip++
-				*reg /= 2
-			}
-			m.Instructions = append(m.Instructions, i)
-		case "tpl":
-			var reg *uint
-			if result[2] == "a" {
-				reg = &m.A
-			} else if result[2] == "b" {
-				reg = &m.B
-			} else {
-				fmt.Println("Unrecognized register")
-				continue
-			}
-			i := func(ip *int) {
-				*ip++
-				*reg *= 3
-			}
-			m.Instructions = append(m.Instructions, i)
-		case "inc":
-			var reg *uint
-			if result[2] == "a" {
-				reg = &m.A
-			} else if result[2] == "b" {
-				reg = &m.B
-			} else {
-				fmt.Println("Unrecognized register")
-				continue
-			}
-			i := func(ip *int) {
-				*ip++
-				*reg += 1
-			}
-			m.Instructions = append(m.Instructions, i)
-		case "jmp":
-			offset := 0
-			if result[2][0] == '+' {
-				parsed, err := strconv.Atoi(result[2][1:])
-				if err != nil {
-					fmt.Println("Unrecognized jump offset")
-					continue
-				}
-				offset = parsed
-			} else if result[2][0] == '-' {
-				parsed, err := strconv.Atoi(result[2][1:])
-				if err != nil {
-					fmt.Println("Unrecognized jump offset")
-					continue
-				}
-				offset = -parsed
-			} else {
-				fmt.Println("Unrecognized jump offset")
-				continue
-			}
-			i := func(ip *int) {
-				*ip += offset
-			}
-			m.Instructions = append(m.Instructions, i)
-		case "jie":
-			var reg *uint
-			if result[2] == "a" {
-				reg = &m.A
-			} else if result[2] == "b" {
-				reg = &m.B
-			} else {
-				fmt.Println("Unrecognized register")
-				continue
-			}
-
-			offset := 0
-			if result[3][0] == '+' {
-				parsed, err := strconv.Atoi(result[3][1:])
-				if err != nil {
-					fmt.Println("Unrecognized jump offset")
-					continue
-				}
-				offset = parsed
-			} else if result[3][0] == '-' {
-				parsed, err := strconv.Atoi(result[3][1:])
-				if err != nil {
-					fmt.Println("Unrecognized jump offset")
-					continue
-				}
-				offset = -parsed
-			} else {
-				fmt.Println("Unrecognized jump offset")
-				continue
-			}
-
-			i := func(ip *int) {
-				if *reg%2 == 0 {
-					*ip += offset
-				} else {
-					*ip++
-				}
-			}
-			m.Instructions = append(m.Instructions, i)
-		case "jio":
-			var reg *uint
-			if result[2] == "a" {
-				reg = &m.A
-			} else if result[2] == "b" {
-				reg = &m.B
-			} else {
-				fmt.Println("Unrecognized register")
-				continue
-			}
-
-			offset := 0
-			if result[3][0] == '+' {
-				parsed, err := strconv.Atoi(result[3][1:])
-				if err != nil {
-					fmt.Println("Unrecognized jump offset")
-					continue
-				}
-				offset = parsed
-			} else if result[3][0] == '-' {
-				parsed, err := strconv.Atoi(result[3][1:])
-				if err != nil {
-					fmt.Println("Unrecognized jump offset")
-					continue
-				}
-				offset = -parsed
-			} else {
-				fmt.Println("Unrecognized jump offset")
-				continue
-			}
-
-			i := func(ip *int) {
-				if *reg == 1 {
-					*ip += offset
-				} else {
-					*ip++
-				}
-			}
-			m.Instructions = append(m.Instructions, i)
-		default:
-			fmt.Println("Unrecognized opcode")
+		return func(ip *int) {
+			*ip += off
+		}, nil
+	}
+
+	reg, err := m.register(arg)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "hlf", "tpl", "inc":
+		if jump != "" {
+			return nil, fmt.Errorf("%s takes one operand", op)
 		}
 	}
+	switch op {
+	case "hlf":
+		return func(ip *int) {
+			*ip++
+			*reg /= 2
+		}, nil
+	case "tpl":
+		return func(ip *int) {
+			*ip++
+			*reg *= 3
+		}, nil
+	case "inc":
+		return func(ip *int) {
+			*ip++
+			*reg += 1
+		}, nil
+	}
 
-	for m.Execute() {
-		if trace {
-			fmt.Println(m.InstructionPointer)
+	off, err := offset(jump)
+	if err != nil {
+		return nil, err
+	}
+	cond := func() bool { return *reg%2 == 0 }
+	if op == "jio" {
+		cond = func() bool { return *reg == 1 }
+	}
+	return func(ip *int) {
+		if cond() {
+			*ip += off
+		} else {
+			*ip++
+		}
+	}, nil
+}
+
+// Load compiles a program, one instruction per line.
+func (m *Machine) Load(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		i, err := m.compile(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		m.Instructions = append(m.Instructions, i)
+		m.Source = append(m.Source, text)
+	}
+	return scanner.Err()
+}
+
+func main() {
+	flag.Parse()
+
+	in := io.Reader(os.Stdin)
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			fmt.Printf("Could not open file %s because %v.\n", *inputFile, err)
+			return
+		}
+		defer f.Close()
+		in = f
+	}
+
+	m := Machine{A: *initA, B: *initB}
+	if err := m.Load(in); err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
+	}
+
+	for {
+		if *trace && m.InstructionPointer >= 0 && m.InstructionPointer < len(m.Source) {
+			fmt.Printf("IP: %d (%s) -- A: %d B: %d\n", m.InstructionPointer, m.Source[m.InstructionPointer], m.A, m.B)
+		}
+		if !m.Execute() {
+			break
 		}
 	}
 
@@ -1,108 +1,135 @@
 package main
 
 import (
-	"bufio"
+	"circuit"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
 	"strconv"
+	"strings"
 )
 
-type PendingOp struct {
-	IVars []string
-	Eval  func(inputs []uint16) uint16
+// overrideFlags collects repeated -override wire=value flags.
+type overrideFlags []override
+
+type override struct {
+	wire  string
+	value uint16
 }
 
-func main() {
-	reader := bufio.NewReader(os.Stdin)
+func (o *overrideFlags) String() string {
+	var parts []string
+	for _, ov := range *o {
+		parts = append(parts, fmt.Sprintf("%s=%d", ov.wire, ov.value))
+	}
+	return strings.Join(parts, ",")
+}
 
-	r := regexp.MustCompile("^(.+) -> ([a-z]+)$")
+func (o *overrideFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected wire=value, got %q", s)
+	}
+	v, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return fmt.Errorf("bad signal %q: %v", parts[1], err)
+	}
+	*o = append(*o, override{parts[0], uint16(v)})
+	return nil
+}
 
-	simple := regexp.MustCompile("^([0-9]+|[a-z]+)$")
-	binop := regexp.MustCompile("^([a-z]+|[0-9]+) (AND|OR) ([a-z]+)$")
-	shift := regexp.MustCompile("^([a-z]+) (LSHIFT|RSHIFT) ([0-9]+)$")
-	unary := regexp.MustCompile("^(NOT) ([a-z]+)$")
+var inputFile = flag.String("inputFile", "", "File to read the circuit from; standard input if empty.")
+var wire = flag.String("wire", "a", "The wire whose signal to print.")
+var partB = flag.Bool("partB", false, "Feed the signal on a back into b and print -wire again.")
+var verbose = flag.Bool("verbose", false, "Print how much of the circuit each override re-evaluated.")
+var dotFile = flag.String("dot", "", "If set, write the circuit as a Graphviz graph to this file.")
+var verilogFile = flag.String("verilog", "", "If set, write the circuit as a Verilog module to this file.")
+var overrides overrideFlags
 
-	var resolved map[string]uint16 = make(map[string]uint16)
-	var pending map[string]PendingOp = make(map[string]PendingOp)
+func init() {
+	flag.Var(&overrides, "override", "Force a wire to a signal, as wire=value. May be repeated.")
+}
 
-	// Part b
-	resolved["b"] = 46065
+func main() {
+	flag.Parse()
 
-	for {
-		line, err := reader.ReadString('\n')
+	in := io.Reader(os.Stdin)
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
 		if err != nil {
-			break
+			fmt.Printf("Could not open file %s because %v.\n", *inputFile, err)
+			return
 		}
-		parsed := r.FindStringSubmatch(line[0 : len(line)-1])
-		expr := parsed[1]
-		ovar := parsed[2]
+		defer f.Close()
+		in = f
+	}
 
-		// Part b
-		if ovar == "b" {
-			continue
-		}
+	c, err := circuit.Parse(in)
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
+	}
+	c.Evaluate()
 
-		if r := simple.FindStringSubmatch(expr); r != nil {
-			if val, err := strconv.Atoi(r[1]); err == nil {
-				resolved[ovar] = uint16(val)
-			} else {
-				pending[ovar] = PendingOp{[]string{r[1]}, func(inputs []uint16) uint16 { return inputs[0] }}
-			}
-		} else if r2 := binop.FindStringSubmatch(expr); r2 != nil {
-			if val, err := strconv.Atoi(r2[1]); err == nil {
-				lval := uint16(val)
-				if r2[2] == "AND" {
-					pending[ovar] = PendingOp{[]string{r2[3]}, func(inputs []uint16) uint16 { return lval & inputs[0] }}
-				} else if r2[2] == "OR" {
-					pending[ovar] = PendingOp{[]string{r2[3]}, func(inputs []uint16) uint16 { return lval | inputs[0] }}
-				} else {
-					fmt.Printf("Unable to parse expression: %s\n", expr)
-				}
-			} else {
-				if r2[2] == "AND" {
-					pending[ovar] = PendingOp{[]string{r2[1], r2[3]}, func(inputs []uint16) uint16 { return inputs[0] & inputs[1] }}
-				} else if r2[2] == "OR" {
-					pending[ovar] = PendingOp{[]string{r2[1], r2[3]}, func(inputs []uint16) uint16 { return inputs[0] | inputs[1] }}
-				} else {
-					fmt.Printf("Unable to parse expression: %s\n", expr)
-				}
-			}
-		} else if r3 := shift.FindStringSubmatch(expr); r3 != nil {
-			offset, _ := strconv.Atoi(r3[3])
-			if r3[2] == "RSHIFT" {
-				pending[ovar] = PendingOp{[]string{r3[1]}, func(inputs []uint16) uint16 { return inputs[0] >> uint(offset) }}
-			} else if r3[2] == "LSHIFT" {
-				pending[ovar] = PendingOp{[]string{r3[1]}, func(inputs []uint16) uint16 { return inputs[0] << uint(offset) }}
-			} else {
-				fmt.Printf("Unable to parse expression: %s\n", expr)
-			}
-		} else if r4 := unary.FindStringSubmatch(expr); r4 != nil {
-			if r4[1] == "NOT" {
-				pending[ovar] = PendingOp{[]string{r4[2]}, func(inputs []uint16) uint16 { return ^inputs[0] }}
-			} else {
-				fmt.Printf("Unable to parse expression: %s\n", expr)
-			}
-		} else {
-			fmt.Printf("Unable to parse expression: %s\n", expr)
+	for _, ov := range overrides {
+		if !apply(c, ov.wire, ov.value) {
 			return
 		}
 	}
-	for len(pending) != 0 {
-	inner:
-		for key := range pending {
-			inputs := make([]uint16, len(pending[key].IVars))
-			ivars := pending[key].IVars
-			for i := range ivars {
-				if val, ok := resolved[ivars[i]]; ok {
-					inputs[i] = val
-				} else {
-					continue inner
-				}
-			}
-			resolved[key] = pending[key].Eval(inputs)
-			delete(pending, key)
+	v, err := c.Value(*wire)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(v)
+
+	if *dotFile != "" {
+		if err := export(*dotFile, func(w io.Writer) error { return c.WriteDOT(w, true) }); err != nil {
+			fmt.Printf("Could not write %s: %v\n", *dotFile, err)
+		}
+	}
+	if *verilogFile != "" {
+		if err := export(*verilogFile, func(w io.Writer) error { return c.WriteVerilog(w, "day7") }); err != nil {
+			fmt.Printf("Could not write %s: %v\n", *verilogFile, err)
+		}
+	}
+
+	if *partB {
+		a, err := c.Value("a")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if !apply(c, "b", a) {
+			return
 		}
+		v, _ = c.Value(*wire)
+		fmt.Println(v)
+	}
+}
+
+func apply(c *circuit.Circuit, wire string, v uint16) bool {
+	n, err := c.Override(wire, v)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if *verbose {
+		cone, _ := c.Cone(wire)
+		fmt.Printf("Overriding %s=%d re-evaluated %d of %d gates downstream (%d in the circuit).\n", wire, v, n, len(cone), len(c.Gates))
+	}
+	return true
+}
+
+func export(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
 	}
-	fmt.Println(resolved["a"])
+	return f.Close()
 }
@@ -0,0 +1,178 @@
+// Package circuit evaluates the bitwise logic circuits of 2015 day 7, where
+// every wire carries a 16-bit signal driven by exactly one gate.
+package circuit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Op int
+
+const (
+	Assign Op = iota
+	And
+	Or
+	LShift
+	RShift
+	Not
+)
+
+var opNames = []string{"", "AND", "OR", "LSHIFT", "RSHIFT", "NOT"}
+
+func (o Op) String() string {
+	if o == Assign {
+		return "ASSIGN"
+	}
+	return opNames[o]
+}
+
+// Input is either a wire or, if Wire is empty, a literal signal.
+type Input struct {
+	Wire string
+	Val  uint16
+}
+
+func (i Input) String() string {
+	if i.Wire != "" {
+		return i.Wire
+	}
+	return strconv.Itoa(int(i.Val))
+}
+
+// Gate drives Output from its inputs.
+type Gate struct {
+	Op     Op
+	Inputs []Input
+	Output string
+	Line   int
+}
+
+func (g *Gate) String() string {
+	var expr string
+	switch g.Op {
+	case Assign:
+		expr = g.Inputs[0].String()
+	case Not:
+		expr = "NOT " + g.Inputs[0].String()
+	default:
+		expr = fmt.Sprintf("%v %v %v", g.Inputs[0], g.Op, g.Inputs[1])
+	}
+	return expr + " -> " + g.Output
+}
+
+// eval computes the gate's output given the values of its inputs.
+func (g *Gate) eval(in []uint16) uint16 {
+	switch g.Op {
+	case And:
+		return in[0] & in[1]
+	case Or:
+		return in[0] | in[1]
+	case LShift:
+		return in[0] << in[1]
+	case RShift:
+		return in[0] >> in[1]
+	case Not:
+		return ^in[0]
+	}
+	return in[0]
+}
+
+// Circuit is a parsed netlist. Gates are kept in topological order, so
+// every gate comes after the gates driving its inputs.
+type Circuit struct {
+	Gates  []*Gate
+	driver map[string]int
+	users  map[string][]int
+
+	values    []uint16
+	evaluated bool
+	overrides map[string]uint16
+}
+
+const (
+	operand = `([a-z]+|[0-9]+)`
+)
+
+var (
+	lineRE   = regexp.MustCompile(`^(.+) -> ([a-z]+)$`)
+	assignRE = regexp.MustCompile(`^` + operand + `$`)
+	binopRE  = regexp.MustCompile(`^` + operand + ` (AND|OR|LSHIFT|RSHIFT) ` + operand + `$`)
+	notRE    = regexp.MustCompile(`^NOT ` + operand + `$`)
+)
+
+func parseInput(s string) (Input, error) {
+	if s[0] >= 'a' && s[0] <= 'z' {
+		return Input{Wire: s}, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return Input{}, fmt.Errorf("bad signal %q", s)
+	}
+	return Input{Val: uint16(v)}, nil
+}
+
+func parseGate(line string) (*Gate, error) {
+	m := lineRE.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("expected \"<expression> -> <wire>\", got %q", line)
+	}
+	expr := m[1]
+	g := &Gate{Output: m[2]}
+	var operands []string
+	if r := assignRE.FindStringSubmatch(expr); r != nil {
+		g.Op, operands = Assign, r[1:]
+	} else if r := notRE.FindStringSubmatch(expr); r != nil {
+		g.Op, operands = Not, r[1:]
+	} else if r := binopRE.FindStringSubmatch(expr); r != nil {
+		for i, name := range opNames {
+			if name == r[2] {
+				g.Op = Op(i)
+			}
+		}
+		operands = []string{r[1], r[3]}
+	} else {
+		return nil, fmt.Errorf("unable to parse expression %q", expr)
+	}
+	for _, o := range operands {
+		in, err := parseInput(o)
+		if err != nil {
+			return nil, err
+		}
+		g.Inputs = append(g.Inputs, in)
+	}
+	return g, nil
+}
+
+// Parse reads a circuit, one gate per line, and sorts it. It is an error
+// for a wire to have no driver or more than one, or for the circuit to
+// contain a loop.
+func Parse(in io.Reader) (*Circuit, error) {
+	var gates []*Gate
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		g, err := parseGate(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		g.Line = line
+		gates = append(gates, g)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return New(gates)
+}
+
+// ParseString is Parse for a circuit held in a string.
+func ParseString(s string) (*Circuit, error) {
+	return Parse(strings.NewReader(s))
+}
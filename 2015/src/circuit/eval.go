@@ -0,0 +1,132 @@
+package circuit
+
+import "fmt"
+
+// Evaluate computes every wire's signal.
+func (c *Circuit) Evaluate() {
+	for i := range c.Gates {
+		c.values[i] = c.compute(i)
+	}
+	c.evaluated = true
+}
+
+// compute returns the signal on gate i's output, given its inputs' current
+// values.
+func (c *Circuit) compute(i int) uint16 {
+	g := c.Gates[i]
+	if v, ok := c.overrides[g.Output]; ok {
+		return v
+	}
+	var in [2]uint16
+	for k, input := range g.Inputs {
+		if input.Wire == "" {
+			in[k] = input.Val
+		} else {
+			in[k] = c.values[c.driver[input.Wire]]
+		}
+	}
+	return g.eval(in[:len(g.Inputs)])
+}
+
+// Value returns the signal on a wire, evaluating the circuit first if
+// necessary.
+func (c *Circuit) Value(wire string) (uint16, error) {
+	i, ok := c.driver[wire]
+	if !ok {
+		return 0, fmt.Errorf("no such wire %s", wire)
+	}
+	if !c.evaluated {
+		c.Evaluate()
+	}
+	return c.values[i], nil
+}
+
+// Values returns the signal on every wire.
+func (c *Circuit) Values() map[string]uint16 {
+	if !c.evaluated {
+		c.Evaluate()
+	}
+	ret := make(map[string]uint16, len(c.Gates))
+	for i, g := range c.Gates {
+		ret[g.Output] = c.values[i]
+	}
+	return ret
+}
+
+// Override forces a wire to v in place of its gate, as part B does to wire
+// b, and re-evaluates only the wires downstream of it. It returns how many
+// gates were recomputed.
+func (c *Circuit) Override(wire string, v uint16) (int, error) {
+	if _, ok := c.driver[wire]; !ok {
+		return 0, fmt.Errorf("no such wire %s", wire)
+	}
+	c.overrides[wire] = v
+	return c.update(wire), nil
+}
+
+// ClearOverride puts a wire's gate back in charge of it, returning how
+// many gates were recomputed.
+func (c *Circuit) ClearOverride(wire string) (int, error) {
+	if _, ok := c.overrides[wire]; !ok {
+		return 0, fmt.Errorf("wire %s is not overridden", wire)
+	}
+	delete(c.overrides, wire)
+	return c.update(wire), nil
+}
+
+// Overrides returns the wires currently overridden and their values.
+func (c *Circuit) Overrides() map[string]uint16 {
+	ret := make(map[string]uint16, len(c.overrides))
+	for k, v := range c.overrides {
+		ret[k] = v
+	}
+	return ret
+}
+
+// update recomputes wire and whatever depends on it. Gates are visited in
+// topological order, and only if one of their inputs actually changed.
+func (c *Circuit) update(wire string) int {
+	if !c.evaluated {
+		c.Evaluate()
+		return len(c.Gates)
+	}
+	start := c.driver[wire]
+	dirty := map[int]bool{start: true}
+	recomputed := 0
+	for i := start; i < len(c.Gates); i++ {
+		if !dirty[i] {
+			continue
+		}
+		recomputed++
+		v := c.compute(i)
+		if v == c.values[i] {
+			continue
+		}
+		c.values[i] = v
+		for _, u := range c.users[c.Gates[i].Output] {
+			dirty[u] = true
+		}
+	}
+	return recomputed
+}
+
+// Cone returns the wires downstream of wire, which is everything an
+// override of it could change, in topological order.
+func (c *Circuit) Cone(wire string) ([]string, error) {
+	start, ok := c.driver[wire]
+	if !ok {
+		return nil, fmt.Errorf("no such wire %s", wire)
+	}
+	in := map[int]bool{start: true}
+	var ret []string
+	for i := start; i < len(c.Gates); i++ {
+		if !in[i] {
+			continue
+		}
+		ret = append(ret, c.Gates[i].Output)
+		for _, u := range c.users[c.Gates[i].Output] {
+			in[u] = true
+		}
+	}
+	return ret, nil
+}
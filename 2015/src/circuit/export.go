@@ -0,0 +1,129 @@
+package circuit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteDOT writes the circuit as a Graphviz digraph with a node per wire,
+// labelled with the gate driving it. If values is set the labels also show
+// each wire's signal.
+func (c *Circuit) WriteDOT(w io.Writer, values bool) error {
+	if values && !c.evaluated {
+		c.Evaluate()
+	}
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "digraph circuit {\n\trankdir=LR;\n\tnode [shape=box, fontname=monospace];\n")
+	for i, g := range c.Gates {
+		label := g.Output
+		if g.Op != Assign || g.Inputs[0].Wire == "" {
+			label += "\n" + expression(g, Input.String)
+		}
+		if values {
+			label += fmt.Sprintf("\n= %d", c.values[i])
+		}
+		attrs := ""
+		if v, ok := c.overrides[g.Output]; ok {
+			label += fmt.Sprintf("\n(overridden to %d)", v)
+			attrs = ", style=filled, fillcolor=lightyellow"
+		}
+		fmt.Fprintf(b, "\t%q [label=%s%s];\n", g.Output, dotQuote(label), attrs)
+	}
+	for _, g := range c.Gates {
+		if _, ok := c.overrides[g.Output]; ok {
+			continue
+		}
+		for _, in := range g.Inputs {
+			if in.Wire != "" {
+				fmt.Fprintf(b, "\t%q -> %q;\n", in.Wire, g.Output)
+			}
+		}
+	}
+	fmt.Fprintf(b, "}\n")
+	return b.Flush()
+}
+
+// dotQuote quotes s as a DOT string, with newlines as line breaks.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// expression formats the gate's inputs and operator, naming each input
+// with name.
+func expression(g *Gate, name func(Input) string) string {
+	switch g.Op {
+	case Assign:
+		return name(g.Inputs[0])
+	case Not:
+		return "NOT " + name(g.Inputs[0])
+	}
+	return fmt.Sprintf("%s %v %s", name(g.Inputs[0]), g.Op, name(g.Inputs[1]))
+}
+
+var verilogOps = map[Op]string{And: "&", Or: "|", LShift: "<<", RShift: ">>"}
+
+// verilogName prefixes wire names, since plenty of two-letter names such
+// as "or", "if" and "do" are Verilog keywords.
+func verilogName(wire string) string {
+	return "w_" + wire
+}
+
+func verilogInput(in Input) string {
+	if in.Wire != "" {
+		return verilogName(in.Wire)
+	}
+	return fmt.Sprintf("16'd%d", in.Val)
+}
+
+// WriteVerilog writes the circuit as a Verilog module of continuous
+// assignments on 16-bit wires. Wires that nothing reads become the module's
+// outputs, and overridden wires are tied to their override.
+func (c *Circuit) WriteVerilog(w io.Writer, module string) error {
+	var outputs, internal []string
+	for _, g := range c.Gates {
+		if len(c.users[g.Output]) == 0 {
+			outputs = append(outputs, g.Output)
+		} else {
+			internal = append(internal, g.Output)
+		}
+	}
+	sort.Strings(outputs)
+	sort.Strings(internal)
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "module %s (\n", module)
+	for i, o := range outputs {
+		sep := ","
+		if i == len(outputs)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(b, "\toutput wire [15:0] %s%s\n", verilogName(o), sep)
+	}
+	fmt.Fprintf(b, ");\n")
+	for _, wire := range internal {
+		fmt.Fprintf(b, "\twire [15:0] %s;\n", verilogName(wire))
+	}
+	fmt.Fprintf(b, "\n")
+	for _, g := range c.Gates {
+		var expr string
+		if v, ok := c.overrides[g.Output]; ok {
+			expr = fmt.Sprintf("16'd%d; // overridden, was %s", v, expression(g, Input.String))
+		} else {
+			switch g.Op {
+			case Assign:
+				expr = verilogInput(g.Inputs[0])
+			case Not:
+				expr = "~" + verilogInput(g.Inputs[0])
+			default:
+				expr = fmt.Sprintf("%s %s %s", verilogInput(g.Inputs[0]), verilogOps[g.Op], verilogInput(g.Inputs[1]))
+			}
+			expr += ";"
+		}
+		fmt.Fprintf(b, "\tassign %s = %s\n", verilogName(g.Output), expr)
+	}
+	fmt.Fprintf(b, "endmodule\n")
+	return b.Flush()
+}
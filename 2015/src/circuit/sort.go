@@ -0,0 +1,120 @@
+package circuit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CycleError reports a loop in the circuit: each wire in Wires feeds the
+// next, and the last feeds the first.
+type CycleError struct {
+	Wires []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("circuit has a loop: %s -> %s", strings.Join(e.Wires, " -> "), e.Wires[0])
+}
+
+// New builds a circuit from gates, sorting them topologically.
+func New(gates []*Gate) (*Circuit, error) {
+	driver := make(map[string]*Gate, len(gates))
+	for _, g := range gates {
+		if prev, ok := driver[g.Output]; ok {
+			return nil, fmt.Errorf("line %d: wire %s is already driven on line %d", g.Line, g.Output, prev.Line)
+		}
+		driver[g.Output] = g
+	}
+
+	// Kahn's algorithm, counting for each gate the inputs still unsorted.
+	pending := make(map[*Gate]int, len(gates))
+	users := make(map[string][]*Gate)
+	var ready []*Gate
+	for _, g := range gates {
+		for _, in := range g.Inputs {
+			if in.Wire == "" {
+				continue
+			}
+			if _, ok := driver[in.Wire]; !ok {
+				return nil, fmt.Errorf("line %d: wire %s has no driver", g.Line, in.Wire)
+			}
+			users[in.Wire] = append(users[in.Wire], g)
+			pending[g]++
+		}
+		if pending[g] == 0 {
+			ready = append(ready, g)
+		}
+	}
+
+	c := &Circuit{
+		driver:    make(map[string]int, len(gates)),
+		users:     make(map[string][]int),
+		overrides: make(map[string]uint16),
+	}
+	for len(ready) > 0 {
+		g := ready[0]
+		ready = ready[1:]
+		c.driver[g.Output] = len(c.Gates)
+		c.Gates = append(c.Gates, g)
+		for _, u := range users[g.Output] {
+			if pending[u]--; pending[u] == 0 {
+				ready = append(ready, u)
+			}
+		}
+	}
+	if len(c.Gates) < len(gates) {
+		return nil, findCycle(gates, driver, pending)
+	}
+
+	for i, g := range c.Gates {
+		for _, in := range g.Inputs {
+			if in.Wire != "" {
+				c.users[in.Wire] = append(c.users[in.Wire], i)
+			}
+		}
+	}
+	c.values = make([]uint16, len(c.Gates))
+	return c, nil
+}
+
+// findCycle walks backwards from an unsorted gate through unsorted inputs.
+// Every unsorted gate has one, so the walk must eventually repeat itself.
+func findCycle(gates []*Gate, driver map[string]*Gate, pending map[*Gate]int) error {
+	var start *Gate
+	for _, g := range gates {
+		if pending[g] > 0 {
+			start = g
+			break
+		}
+	}
+	seen := make(map[*Gate]int)
+	var path []string
+	for g := start; ; {
+		if at, ok := seen[g]; ok {
+			// path runs from each gate to the one driving it; flip it so that
+			// each wire feeds the next.
+			cycle := path[at:]
+			for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+				cycle[i], cycle[j] = cycle[j], cycle[i]
+			}
+			// Start from the alphabetically first wire so the error is stable.
+			min := 0
+			for i := range cycle {
+				if cycle[i] < cycle[min] {
+					min = i
+				}
+			}
+			return &CycleError{append(cycle[min:], cycle[:min]...)}
+		}
+		seen[g] = len(path)
+		path = append(path, g.Output)
+		var next []string
+		for _, in := range g.Inputs {
+			if in.Wire != "" && pending[driver[in.Wire]] > 0 {
+				next = append(next, in.Wire)
+			}
+		}
+		sort.Strings(next)
+		g = driver[next[0]]
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"fmt"
+	"search"
 	"sort"
-	"sync"
 )
 
 const NumFloors int8 = 4
@@ -50,20 +50,7 @@ type Board struct {
 	ElevatorFloor int8
 }
 
-type BoardScore struct {
-	Child Board
-	Score int
-}
-
-type BoardList []BoardScore
-
-func (a BoardList) Len() int      { return len(a) }
-func (a BoardList) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a BoardList) Less(i, j int) bool {
-	return a[i].Score > a[j].Score
-}
-
-func (b *Board) Win() bool {
+func (b Board) Win() bool {
 	for _, item := range b.Items {
 		if item.Isotope() == 0 {
 			continue
@@ -125,8 +112,8 @@ func (b *Board) MakeCopy(newFloor int8, move1, move2 int) Board {
 	return nb
 }
 
-func (b *Board) MakeMoves() BoardList {
-	ret := make(BoardList, 0)
+func (b Board) Moves() []search.Move[BoardKey] {
+	var ret []search.Move[BoardKey]
 	for nf := int8(0); nf < NumFloors; nf++ {
 		if nf == b.ElevatorFloor || nf < b.ElevatorFloor-1 || nf > b.ElevatorFloor+1 {
 			continue
@@ -136,8 +123,8 @@ func (b *Board) MakeMoves() BoardList {
 				continue
 			}
 			child := b.MakeCopy(nf, i, -1)
-			if score := child.Valid(); score >= 0 {
-				ret = append(ret, BoardScore{child, score})
+			if child.Valid() >= 0 {
+				ret = append(ret, search.Move[BoardKey]{To: child, Cost: 1})
 			}
 		}
 		for i, x := range b.Items {
@@ -149,55 +136,57 @@ func (b *Board) MakeMoves() BoardList {
 					continue
 				}
 				child := b.MakeCopy(nf, i, j)
-				if score := child.Valid(); score >= 0 {
-					ret = append(ret, BoardScore{child, score})
+				if child.Valid() >= 0 {
+					ret = append(ret, search.Move[BoardKey]{To: child, Cost: 1})
 				}
 			}
 		}
 	}
-	sort.Sort(ret)
 	return ret
 }
 
-func (b Board) EvalLoop(seen map[Board]uint16, winner *uint16, wMtx *sync.Mutex, wg *sync.WaitGroup) {
-	children := b.MakeMoves()
-	for _, childPair := range children {
-		child := childPair.Child
-		wMtx.Lock()
-		if (seen[child] == 0 || seen[child] > seen[b]+1) && (*winner == 0 || seen[b]+1 < *winner) {
-			seen[child] = seen[b] + 1
-			if child.Win() {
-				*winner = seen[child]
-				wMtx.Unlock()
-				continue
-			}
-			wMtx.Unlock()
-			wg.Add(1)
-			go child.EvalLoop(seen, winner, wMtx, wg)
+// BoardKey identifies boards up to renaming the isotopes: all that matters
+// is which floors each generator and microchip pair are on.
+type BoardKey struct {
+	ElevatorFloor int8
+	Pairs         [7]int8
+}
+
+func (b Board) Key() BoardKey {
+	var gen, chip [8]int8
+	present := [8]bool{}
+	for _, item := range b.Items {
+		if item.Isotope() == 0 {
+			continue
+		}
+		present[item.Isotope()] = true
+		if item.Generator() {
+			gen[item.Isotope()] = item.Floor()
 		} else {
-			wMtx.Unlock()
-			// We've seen this before in equal or more moves OR we've won already in fewer moves.
+			chip[item.Isotope()] = item.Floor()
 		}
 	}
-	wg.Done()
+	k := BoardKey{ElevatorFloor: b.ElevatorFloor}
+	pairs := k.Pairs[:0]
+	for iso := 1; iso < 8; iso++ {
+		if present[iso] {
+			pairs = append(pairs, gen[iso]*NumFloors+chip[iso])
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i] < pairs[j] })
+	for i := len(pairs); i < len(k.Pairs); i++ {
+		k.Pairs[i] = -1
+	}
+	return k
 }
 
-func (b Board) ProcessBoard() uint16 {
-	b.Valid()
-
-	winner := uint16(0)
-
-	seen := make(map[Board]uint16)
-	seen[b] = uint16(1)
-	var mtx sync.Mutex
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	b.EvalLoop(seen, &winner, &mtx, &wg)
-	wg.Wait()
-
-	fmt.Println(len(seen))
-	return winner - seen[b]
+func (b Board) ProcessBoard() int {
+	r, ok := search.BFS[BoardKey](b)
+	if !ok {
+		return -1
+	}
+	fmt.Println(r.Expanded)
+	return r.Moves()
 }
 
 func main() {
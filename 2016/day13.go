@@ -2,8 +2,7 @@ package main
 
 import (
 	"fmt"
-	"sort"
-	"sync"
+	"search"
 )
 
 const winX int8 = 31
@@ -37,98 +36,35 @@ func (c Coord) IsPassable() bool {
 	return Popcount64(val)%2 == 0
 }
 
-type BoardScore struct {
-	Child Coord
-	Score int
-}
-
-type BoardList []BoardScore
-
-func (a BoardList) Len() int      { return len(a) }
-func (a BoardList) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a BoardList) Less(i, j int) bool {
-	return a[i].Score < a[j].Score
+func (c Coord) Key() Coord {
+	return c
 }
 
 func (c Coord) Win() bool {
 	return c.X == winX && c.Y == winY
 }
 
-func (c Coord) Valid() int {
-	if !c.IsPassable() {
-		return -1
-	}
-	xDelta := int(c.X - winX)
-	yDelta := int(c.Y - winY)
-	return xDelta*xDelta + yDelta*yDelta
-}
-
-func (c Coord) MakeMoves() BoardList {
-	ret := make(BoardList, 0)
-	up := Coord{c.X, c.Y + 1}
-	down := Coord{c.X, c.Y - 1}
-	left := Coord{c.X - 1, c.Y}
-	right := Coord{c.X + 1, c.Y}
-	if score := up.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{up, score})
-	}
-	if score := down.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{down, score})
-	}
-	if score := left.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{left, score})
-	}
-	if score := right.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{right, score})
+func (c Coord) Moves() []search.Move[Coord] {
+	var ret []search.Move[Coord]
+	for _, n := range []Coord{{c.X, c.Y + 1}, {c.X, c.Y - 1}, {c.X - 1, c.Y}, {c.X + 1, c.Y}} {
+		if n.IsPassable() {
+			ret = append(ret, search.Move[Coord]{To: n, Cost: 1})
+		}
 	}
-	sort.Sort(ret)
 	return ret
 }
 
-func (c Coord) EvalLoop(seen map[Coord]uint16, winner *uint16, wMtx *sync.Mutex, wg *sync.WaitGroup) {
-	children := c.MakeMoves()
-	for _, childPair := range children {
-		child := childPair.Child
-		wMtx.Lock()
-		if (seen[child] == 0 || seen[child] > seen[c]+1) && (*winner == 0 || seen[c]+1 < *winner) {
-			seen[child] = seen[c] + 1
-			if child.Win() {
-				*winner = seen[child]
-				wMtx.Unlock()
-				continue
-			}
-			wMtx.Unlock()
-			wg.Add(1)
-			go child.EvalLoop(seen, winner, wMtx, wg)
-		} else {
-			wMtx.Unlock()
-			// We've seen this before in equal or more moves OR we've won already in fewer moves.
-		}
-	}
-	wg.Done()
+// Distance is a lower bound on the moves from c to the goal.
+func Distance(s search.State[Coord]) int {
+	c := s.(Coord)
+	return abs(int(c.X-winX)) + abs(int(c.Y-winY))
 }
 
-func (c Coord) ProcessBoard() uint16 {
-	winner := uint16(0)
-
-	seen := make(map[Coord]uint16)
-	seen[c] = uint16(1)
-	var mtx sync.Mutex
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	c.EvalLoop(seen, &winner, &mtx, &wg)
-	wg.Wait()
-
-	fmt.Println(len(seen))
-	in50 := 0
-	for _, steps := range seen {
-		if steps-seen[c] <= 50 {
-			in50++
-		}
+func abs(x int) int {
+	if x < 0 {
+		return -x
 	}
-	fmt.Println(in50)
-	return winner - seen[c]
+	return x
 }
 
 func main() {
@@ -150,5 +86,11 @@ func main() {
 			fmt.Println()
 		}
 	}
-	fmt.Println(start.ProcessBoard())
+	r, ok := search.AStar[Coord](start, Distance)
+	if !ok {
+		fmt.Println("Not Found")
+		return
+	}
+	fmt.Println(r.Moves())
+	fmt.Println(len(search.Reachable[Coord](start, 50)))
 }
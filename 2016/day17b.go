@@ -4,8 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"sort"
-	"sync"
+	"search"
 )
 
 const winX int8 = 3
@@ -47,17 +46,8 @@ func (c Coord) IsPassable() bool {
 	return ret
 }
 
-type BoardScore struct {
-	Child Coord
-	Score int
-}
-
-type BoardList []BoardScore
-
-func (a BoardList) Len() int      { return len(a) }
-func (a BoardList) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a BoardList) Less(i, j int) bool {
-	return a[i].Score < a[j].Score
+func (c Coord) Key() string {
+	return string(c.History)
 }
 
 func (c Coord) Win() bool {
@@ -73,8 +63,8 @@ func (c Coord) Valid() int {
 	return xDelta*xDelta + yDelta*yDelta
 }
 
-func (c Coord) MakeMoves() BoardList {
-	ret := make(BoardList, 0)
+func (c Coord) Moves() []search.Move[string] {
+	var ret []search.Move[string]
 
 	upHist := make([]byte, len(c.History)+1)
 	copy(upHist, c.History)
@@ -94,55 +84,27 @@ func (c Coord) MakeMoves() BoardList {
 	left := Coord{c.X - 1, c.Y, leftHist}
 	right := Coord{c.X + 1, c.Y, rightHist}
 
-	if score := up.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{up, score})
+	if up.Valid() >= 0 {
+		ret = append(ret, search.Move[string]{To: up, Cost: 1})
 	}
-	if score := down.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{down, score})
+	if down.Valid() >= 0 {
+		ret = append(ret, search.Move[string]{To: down, Cost: 1})
 	}
-	if score := left.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{left, score})
+	if left.Valid() >= 0 {
+		ret = append(ret, search.Move[string]{To: left, Cost: 1})
 	}
-	if score := right.Valid(); score >= 0 {
-		ret = append(ret, BoardScore{right, score})
+	if right.Valid() >= 0 {
+		ret = append(ret, search.Move[string]{To: right, Cost: 1})
 	}
-	sort.Sort(ret)
 	return ret
 }
 
-func (c Coord) EvalLoop(winner *[]byte, wMtx *sync.Mutex, wg *sync.WaitGroup) {
-	children := c.MakeMoves()
-	for _, childPair := range children {
-		child := childPair.Child
-		wMtx.Lock()
-		if child.Win() && len(*winner) < len(child.History) {
-			*winner = child.History
-			wMtx.Unlock()
-			continue
-		}
-		wMtx.Unlock()
-		if !child.Win() {
-			wg.Add(1)
-			go child.EvalLoop(winner, wMtx, wg)
-		}
-	}
-	wg.Done()
-}
-
 func (c Coord) ProcessBoard() string {
-	var winner []byte
-
-	var mtx sync.Mutex
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	c.EvalLoop(&winner, &mtx, &wg)
-	wg.Wait()
-
-	if winner != nil {
-		return string(winner)
+	r, ok := search.Longest[string](c)
+	if !ok {
+		return "Not Found"
 	}
-	return "Not Found"
+	return r.Last().Key()
 }
 
 func main() {
@@ -4,10 +4,9 @@ import (
 	"fmt"
 	"log"
 	"regexp"
-	"sort"
+	"search"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 type Coord struct {
@@ -20,22 +19,22 @@ type Move struct {
 	From, To Coord
 }
 
-type Board struct {
-	Target          Coord
+// Grid is the fixed part of the puzzle. Data can only ever move into the
+// empty node, and nodes whose data won't fit there are walls, so a board
+// comes down to where the empty node and the data we want are.
+type Grid struct {
 	Usage, Capacity State
+	// Room is the empty node's capacity.
+	Room uint16
 }
 
-type BoardScore struct {
-	Child Board
-	Score int
+type Board struct {
+	Empty, Target Coord
+	Grid          *Grid
 }
 
-type BoardList []BoardScore
-
-func (a BoardList) Len() int      { return len(a) }
-func (a BoardList) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a BoardList) Less(i, j int) bool {
-	return a[i].Score > a[j].Score
+type BoardKey struct {
+	Empty, Target Coord
 }
 
 func findAllMoves(usage, capacity State) []Move {
@@ -56,32 +55,6 @@ func findAllMoves(usage, capacity State) []Move {
 	return ret
 }
 
-func findAdjacentMoves(usage, capacity State) []Move {
-	ret := make([]Move, 0)
-	for f, u := range usage {
-		if u == 0 {
-			continue
-		}
-		up := Coord{X: f.X, Y: f.Y + 1}
-		down := Coord{X: f.X, Y: f.Y - 1}
-		left := Coord{X: f.X + 1, Y: f.Y}
-		right := Coord{X: f.X - 1, Y: f.Y}
-		if usage[up]+u <= capacity[up] {
-			ret = append(ret, Move{From: f, To: up})
-		}
-		if usage[down]+u <= capacity[down] {
-			ret = append(ret, Move{From: f, To: down})
-		}
-		if usage[left]+u <= capacity[left] {
-			ret = append(ret, Move{From: f, To: left})
-		}
-		if usage[right]+u <= capacity[right] {
-			ret = append(ret, Move{From: f, To: right})
-		}
-	}
-	return ret
-}
-
 func parse(input []string) (State, State) {
 	capacity := make(State)
 	usage := make(State)
@@ -104,78 +77,103 @@ func parse(input []string) (State, State) {
 	return usage, capacity
 }
 
-func (b Board) Win() bool {
-	return b.Target == Coord{0, 0}
+func NewBoard(usage, capacity State, target Coord) (Board, error) {
+	b := Board{Target: target, Grid: &Grid{Usage: usage, Capacity: capacity}}
+	found := false
+	for c, u := range usage {
+		if u == 0 {
+			if found {
+				return b, fmt.Errorf("more than one empty node")
+			}
+			b.Empty, b.Grid.Room, found = c, capacity[c], true
+		}
+	}
+	if !found {
+		return b, fmt.Errorf("no empty node")
+	}
+
+	// Check that the grid really is fixed: movable data fits wherever the
+	// empty node can go, walls fit nowhere, and nothing can be merged.
+	for c, u := range usage {
+		wall := u > b.Grid.Room
+		for d, size := range capacity {
+			if c == d || usage[d] > b.Grid.Room {
+				continue
+			}
+			if wall && u <= size {
+				return b, fmt.Errorf("wall at %v could move into %v", c, d)
+			}
+			if !wall && u > size {
+				return b, fmt.Errorf("data at %v doesn't fit in %v", c, d)
+			}
+		}
+	}
+	for _, m := range findAllMoves(usage, capacity) {
+		if usage[m.To] != 0 {
+			return b, fmt.Errorf("data at %v could be merged into %v", m.From, m.To)
+		}
+	}
+	return b, nil
 }
 
-func (b Board) Valid() int {
-	x := int(b.Target.X)
-	y := int(b.Target.Y)
-	return x*x + y*y
+func (b Board) Key() BoardKey {
+	return BoardKey{b.Empty, b.Target}
 }
 
-func (b Board) MakeMoves() BoardList {
-	ret := make(BoardList, 0)
+func (b Board) Win() bool {
+	return b.Target == Coord{0, 0}
+}
 
-	for _, m := range findAdjacentMoves(b.Usage, b.Capacity) {
-		child := b
-		transfer := b.Usage[m.From]
-		child.Usage = make(State)
-		if b.Target == m.From {
-			child.Target = m.To
-		}
-		for k, v := range b.Usage {
-			if k == m.From {
-				child.Usage[k] = 0
-			} else if k == m.To {
-				child.Usage[k] = transfer + b.Usage[k]
-			} else {
-				child.Usage[k] = v
-			}
+// Moves shifts the data from a neighbour into the empty node.
+func (b Board) Moves() []search.Move[BoardKey] {
+	var ret []search.Move[BoardKey]
+	e := b.Empty
+	for _, n := range []Coord{{e.X, e.Y + 1}, {e.X, e.Y - 1}, {e.X + 1, e.Y}, {e.X - 1, e.Y}} {
+		u, ok := b.Grid.Usage[n]
+		if !ok || u > b.Grid.Room {
+			continue
 		}
-
-		if score := child.Valid(); score >= 0 {
-			ret = append(ret, BoardScore{child, score})
+		child := b
+		child.Empty = n
+		if n == b.Target {
+			child.Target = e
 		}
+		ret = append(ret, search.Move[BoardKey]{To: child, Cost: 1})
 	}
-
-	sort.Sort(ret)
 	return ret
 }
 
-func (b Board) EvalLoop(winner *uint8, wMtx *sync.Mutex, wg *sync.WaitGroup, depth uint8) {
-	children := b.MakeMoves()
-	for _, childPair := range children {
-		child := childPair.Child
-		wMtx.Lock()
-		if *winner == 0 || depth < *winner {
-			if child.Win() {
-				*winner = depth + 1
-				wMtx.Unlock()
-				continue
-			}
-			wMtx.Unlock()
-			wg.Add(1)
-			go child.EvalLoop(winner, wMtx, wg, depth+1)
-		} else {
-			wMtx.Unlock()
-			// We've seen this before in equal or more moves OR we've won already in fewer moves.
-		}
+func distance(a, b Coord) int {
+	dx := int(a.X) - int(b.X)
+	dy := int(a.Y) - int(b.Y)
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
 	}
-	wg.Done()
+	return dx + dy
 }
 
-func (b Board) ProcessBoard() uint8 {
-	winner := uint8(0)
-
-	var mtx sync.Mutex
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	b.EvalLoop(&winner, &mtx, &wg, 0)
-	wg.Wait()
+// MovesLeft is a lower bound on the moves to get the target data home. The
+// empty node has to reach it before the first step, and then get around to
+// the far side for each later one, which takes at least three moves on a
+// staircase.
+func MovesLeft(s search.State[BoardKey]) int {
+	b := s.(Board)
+	home := distance(b.Target, Coord{0, 0})
+	if home == 0 {
+		return 0
+	}
+	return distance(b.Empty, b.Target) + 3*(home-1)
+}
 
-	return winner
+func (b Board) ProcessBoard() int {
+	r, ok := search.AStar[BoardKey](b, MovesLeft)
+	if !ok {
+		return -1
+	}
+	return r.Moves()
 }
 
 func main() {
@@ -190,7 +188,10 @@ func main() {
 /dev/grid/node-x2-y2    9T    6T     3T   66%`, "\n")
 	usage, capacity := parse(demo)
 
-	start := Board{Usage: usage, Capacity: capacity, Target: Coord{2, 0}}
+	start, err := NewBoard(usage, capacity, Coord{2, 0})
+	if err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println(start.ProcessBoard())
 
 	input := strings.Split(`/dev/grid/node-x0-y0     85T   72T    13T   84%
@@ -1156,6 +1157,9 @@ func main() {
 	usage, capacity = parse(input)
 	fmt.Println(len(findAllMoves(usage, capacity)))
 
-	start = Board{Usage: usage, Capacity: capacity, Target: Coord{31, 0}}
+	start, err = NewBoard(usage, capacity, Coord{31, 0})
+	if err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println(start.ProcessBoard())
 }
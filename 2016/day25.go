@@ -1,43 +1,70 @@
 package main
 
 import (
+	"assembunny"
+	"flag"
 	"fmt"
 )
 
-func main() {
-test:
-	for i := 0; ; i++ {
-		successes := 0
-		last := 1
+var maxSteps = flag.Int("maxSteps", 1000000, "How many instructions to run for each value before giving up on it.")
+var verbose = flag.Bool("verbose", false, "Print the outcome of every value tried.")
+var optimize = flag.Bool("optimize", true, "Run recognised add and multiply loops in one step.")
 
-		d := i + 365*7
-		b := d
+const input = `cpy a d
+cpy 7 c
+cpy 365 b
+inc d
+dec b
+jnz b -2
+dec c
+jnz c -5
+cpy d a
+jnz 0 0
+cpy a b
+cpy 0 a
+cpy 2 c
+jnz b 2
+jnz 1 6
+dec b
+dec c
+jnz c -4
+inc a
+jnz 1 -7
+cpy 2 b
+jnz c 2
+jnz 1 4
+dec b
+dec c
+jnz 1 -4
+jnz 0 0
+out b
+jnz a -19
+jnz 1 -21`
 
-		for {
-			c := b % 2
-			b = b >> 1
+func main() {
+	flag.Parse()
+	set := assembunny.Base.With(assembunny.Output)
+	p, err := assembunny.ParseString(input, set)
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
+	}
 
-			if !emit(c, last, &successes) {
-				continue test
-			}
-			if successes == 100 {
-				fmt.Println(i)
-				return
-			}
-			last = c
-			if b != 0 {
-				continue
-			} else {
-				b = d
+	for i := 0; ; i++ {
+		m := assembunny.New(p, set)
+		m.Optimize = *optimize
+		m.Regs[0] = i
+
+		r := assembunny.Check(m, assembunny.Repeating(0, 1), *maxSteps)
+		if *verbose {
+			fmt.Printf("a=%d: %v after %d steps, outputs %v\n", i, r.Verdict, r.Steps, r.Outputs)
+		}
+		if r.Verdict == assembunny.Holds {
+			fmt.Println(i)
+			if *verbose {
+				fmt.Printf("Outputs from %d on repeat forever\n", r.LoopStart)
 			}
+			return
 		}
 	}
 }
-
-func emit(b int, last int, successes *int) bool {
-	if b == last {
-		return false
-	}
-	*successes++
-	return true
-}
@@ -0,0 +1,289 @@
+// Package assembunny is the register machine of 2016 days 12, 23 and 25.
+package assembunny
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// An Operand names a register (a-d) or holds a number.
+type Operand struct {
+	IsReg bool
+	Reg   int // 0 for a through 3 for d.
+	Val   int
+}
+
+func (o Operand) String() string {
+	if o.IsReg {
+		return string(rune('a' + o.Reg))
+	}
+	return strconv.Itoa(o.Val)
+}
+
+type Instruction struct {
+	Op   string
+	Args []Operand
+}
+
+func (i Instruction) String() string {
+	parts := []string{i.Op}
+	for _, a := range i.Args {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+type Program []Instruction
+
+// Op advances IP itself and must cope with nonsense operands made by tgl.
+type Op struct {
+	Arity int
+	Exec  func(m *Machine, args []Operand)
+}
+
+// InstructionSet is keyed by mnemonic.
+type InstructionSet map[string]Op
+
+// Base is the instruction set of day 12.
+var Base = InstructionSet{
+	"cpy": {2, func(m *Machine, args []Operand) {
+		if args[1].IsReg {
+			m.Regs[args[1].Reg] = m.Value(args[0])
+		}
+		m.IP++
+	}},
+	"inc": {1, func(m *Machine, args []Operand) {
+		if args[0].IsReg {
+			m.Regs[args[0].Reg]++
+		}
+		m.IP++
+	}},
+	"dec": {1, func(m *Machine, args []Operand) {
+		if args[0].IsReg {
+			m.Regs[args[0].Reg]--
+		}
+		m.IP++
+	}},
+	"jnz": {2, func(m *Machine, args []Operand) {
+		if m.Value(args[0]) != 0 {
+			m.IP += m.Value(args[1])
+		} else {
+			m.IP++
+		}
+	}},
+}
+
+// Toggle adds day 23's tgl.
+var Toggle = InstructionSet{
+	"tgl": {1, func(m *Machine, args []Operand) {
+		target := m.IP + m.Value(args[0])
+		if target >= 0 && target < len(m.Program) {
+			in := &m.Program[target]
+			if len(in.Args) == 1 {
+				if in.Op == "inc" {
+					in.Op = "dec"
+				} else {
+					in.Op = "inc"
+				}
+			} else {
+				if in.Op == "jnz" {
+					in.Op = "cpy"
+				} else {
+					in.Op = "jnz"
+				}
+			}
+			m.Toggles[target]++
+			m.Invalidate(target)
+		}
+		m.IP++
+	}},
+}
+
+// Output adds day 25's out.
+var Output = InstructionSet{
+	"out": {1, func(m *Machine, args []Operand) {
+		m.IP++
+		if m.Out != nil && !m.Out(m.Value(args[0])) {
+			m.Stopped = true
+		}
+	}},
+}
+
+// With merges two instruction sets.
+func (s InstructionSet) With(other InstructionSet) InstructionSet {
+	ret := make(InstructionSet, len(s)+len(other))
+	for k, v := range s {
+		ret[k] = v
+	}
+	for k, v := range other {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Parse checks each line's mnemonic and operand count against set.
+func Parse(in io.Reader, set InstructionSet) (Program, error) {
+	var p Program
+	scanner := bufio.NewScanner(in)
+	for ln := 1; scanner.Scan(); ln++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		op, ok := set[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown instruction %q", ln, fields[0])
+		}
+		if len(fields)-1 != op.Arity {
+			return nil, fmt.Errorf("line %d: %s takes %d operands, got %d", ln, fields[0], op.Arity, len(fields)-1)
+		}
+		i := Instruction{Op: fields[0]}
+		for _, f := range fields[1:] {
+			arg, err := parseOperand(f)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", ln, err)
+			}
+			i.Args = append(i.Args, arg)
+		}
+		p = append(p, i)
+	}
+	return p, scanner.Err()
+}
+
+// ParseString parses a program literal.
+func ParseString(s string, set InstructionSet) (Program, error) {
+	return Parse(strings.NewReader(s), set)
+}
+
+func parseOperand(s string) (Operand, error) {
+	if len(s) == 1 && s[0] >= 'a' && s[0] <= 'd' {
+		return Operand{IsReg: true, Reg: int(s[0] - 'a')}, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return Operand{}, fmt.Errorf("operand %q is neither a register nor a number", s)
+	}
+	return Operand{Val: v}, nil
+}
+
+// decoded caches an instruction's op; exec is nil if it is invalid.
+type decoded struct {
+	exec func(m *Machine, args []Operand)
+	args []Operand
+}
+
+type Machine struct {
+	Regs    [4]int
+	IP      int
+	Program Program
+	Set     InstructionSet
+	Steps   int
+	// Toggles counts how often tgl has rewritten each instruction.
+	Toggles []int
+
+	// Out returns false to stop the machine.
+	Out func(v int) bool
+	// Trace sees the machine after each instruction.
+	Trace   func(m *Machine)
+	Stopped bool
+	// Optimize collapses add and multiply loops unless tracing.
+	Optimize bool
+
+	decoded []decoded
+	macros  []macro
+}
+
+// New copies p so that tgl leaves the original alone.
+func New(p Program, set InstructionSet) *Machine {
+	m := &Machine{
+		Program: append(Program(nil), p...),
+		Set:     set,
+		Toggles: make([]int, len(p)),
+		decoded: make([]decoded, len(p)),
+		macros:  make([]macro, len(p)),
+	}
+	for i := range m.Program {
+		m.decode(i)
+	}
+	for i := range m.Program {
+		m.macros[i] = m.match(i)
+	}
+	return m
+}
+
+// Invalidate must be called after editing m.Program[i] by hand.
+func (m *Machine) Invalidate(i int) {
+	m.decode(i)
+	m.rematch(i)
+}
+
+func (m *Machine) decode(i int) {
+	in := m.Program[i]
+	op, ok := m.Set[in.Op]
+	if !ok || len(in.Args) != op.Arity {
+		// Toggling can produce instructions outside the set.
+		m.decoded[i] = decoded{}
+		return
+	}
+	m.decoded[i] = decoded{op.Exec, in.Args}
+}
+
+// Toggled returns the indexes of every instruction tgl has rewritten.
+func (m *Machine) Toggled() []int {
+	ret := make([]int, 0)
+	for i, n := range m.Toggles {
+		if n > 0 {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// Value resolves an operand.
+func (m *Machine) Value(o Operand) int {
+	if o.IsReg {
+		return m.Regs[o.Reg]
+	}
+	return o.Val
+}
+
+// Halted is true once IP is out of range or Out has refused a value.
+func (m *Machine) Halted() bool {
+	return m.Stopped || m.IP < 0 || m.IP >= len(m.Program)
+}
+
+// Step runs one instruction unless halted.
+func (m *Machine) Step() bool {
+	if m.Halted() {
+		return false
+	}
+	if m.Optimize && m.Trace == nil {
+		if mc := m.macros[m.IP]; mc != nil && mc(m) {
+			return true
+		}
+	}
+	if d := m.decoded[m.IP]; d.exec == nil {
+		m.IP++
+	} else {
+		d.exec(m, d.args)
+	}
+	m.Steps++
+	if m.Trace != nil {
+		m.Trace(m)
+	}
+	return true
+}
+
+// Run stops after maxSteps steps if that is positive, and reports whether
+// the machine halted.
+func (m *Machine) Run(maxSteps int) bool {
+	for steps := 0; maxSteps <= 0 || steps < maxSteps; steps++ {
+		if !m.Step() {
+			return true
+		}
+	}
+	return m.Halted()
+}
@@ -0,0 +1,117 @@
+package assembunny
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pattern accepts or rejects the i'th output v. A positive Period, after
+// which Match repeats, lets Check prove a looping program right forever.
+type Pattern struct {
+	Period int
+	Match  func(i, v int) bool
+}
+
+// Repeating returns a pattern matching values, over and over.
+func Repeating(values ...int) Pattern {
+	return Pattern{len(values), func(i, v int) bool {
+		return v == values[i%len(values)]
+	}}
+}
+
+// Each returns a pattern requiring every output to satisfy f.
+func Each(f func(v int) bool) Pattern {
+	return Pattern{1, func(_, v int) bool { return f(v) }}
+}
+
+type Verdict int
+
+const (
+	// Undecided means the step limit ran out before a verdict.
+	Undecided Verdict = iota
+	// Holds means the machine looped back to an earlier state.
+	Holds
+	// Violated means an output didn't match.
+	Violated
+	// Finished means the machine halted with every output matching.
+	Finished
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Undecided:
+		return "undecided"
+	case Holds:
+		return "holds"
+	case Violated:
+		return "violated"
+	case Finished:
+		return "finished"
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// Report is what Check saw; for Holds, Outputs[LoopStart:] repeats.
+type Report struct {
+	Verdict   Verdict
+	Outputs   []int
+	Steps     int
+	LoopStart int
+}
+
+// checkState determines the machine's future and the pattern's phase.
+type checkState struct {
+	regs    [4]int
+	ip      int
+	phase   int
+	program string
+}
+
+// Check takes over m.Out and runs m until a verdict is reached or, if
+// maxSteps is positive, it gives up.
+func Check(m *Machine, p Pattern, maxSteps int) Report {
+	var r Report
+	seen := make(map[checkState]int)
+	output := false
+	m.Out = func(v int) bool {
+		r.Outputs = append(r.Outputs, v)
+		if !p.Match(len(r.Outputs)-1, v) {
+			r.Verdict = Violated
+			return false
+		}
+		output = true
+		return true
+	}
+
+	start := m.Steps
+	for maxSteps <= 0 || m.Steps-start < maxSteps {
+		if !m.Step() {
+			if r.Verdict != Violated {
+				r.Verdict = Finished
+			}
+			break
+		}
+		if !output || p.Period <= 0 {
+			continue
+		}
+		output = false
+		s := checkState{m.Regs, m.IP, len(r.Outputs) % p.Period, m.opcodes()}
+		if at, ok := seen[s]; ok {
+			r.Verdict = Holds
+			r.LoopStart = at
+			break
+		}
+		seen[s] = len(r.Outputs)
+	}
+	r.Steps = m.Steps - start
+	return r
+}
+
+// opcodes captures what tgl can change, which is only the names.
+func (m *Machine) opcodes() string {
+	ops := make([]string, len(m.Program))
+	for i, in := range m.Program {
+		ops[i] = in.Op
+	}
+	return strings.Join(ops, " ")
+}
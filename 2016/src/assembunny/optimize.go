@@ -0,0 +1,145 @@
+package assembunny
+
+// A macro runs a whole loop at once, returning false if the registers are
+// such that it can't (for instance a counter that would never reach zero),
+// in which case the instructions run one at a time as usual.
+type macro func(m *Machine) bool
+
+// Loops are matched over at most this many instructions.
+const maxMacroLen = 6
+
+// step reports whether instruction i is a valid inc or dec of a register,
+// returning the register and +1 or -1.
+func (m *Machine) step(i int) (reg, delta int, ok bool) {
+	in := m.Program[i]
+	if m.decoded[i].exec == nil || !in.Args[0].IsReg {
+		return 0, 0, false
+	}
+	switch in.Op {
+	case "inc":
+		return in.Args[0].Reg, 1, true
+	case "dec":
+		return in.Args[0].Reg, -1, true
+	}
+	return 0, 0, false
+}
+
+// loopsBack reports whether instruction i is "jnz reg -offset".
+func (m *Machine) loopsBack(i, reg, offset int) bool {
+	in := m.Program[i]
+	return m.decoded[i].exec != nil && in.Op == "jnz" &&
+		in.Args[0].IsReg && in.Args[0].Reg == reg &&
+		!in.Args[1].IsReg && in.Args[1].Val == -offset
+}
+
+// iterations returns how many times a loop runs whose counter starts at v
+// and moves by delta each time until it reaches zero.
+func iterations(v, delta int) (int, bool) {
+	n := -v * delta
+	return n, n > 0
+}
+
+// addLoop matches
+//
+//	inc x
+//	dec y
+//	jnz y -2
+//
+// in either order and with either of inc or dec, which adds or subtracts y
+// to x and clears y.
+func (m *Machine) addLoop(i int) (x, dx, y, dy int, ok bool) {
+	if i+3 > len(m.Program) {
+		return
+	}
+	r1, d1, ok1 := m.step(i)
+	r2, d2, ok2 := m.step(i + 1)
+	if !ok1 || !ok2 || r1 == r2 {
+		return 0, 0, 0, 0, false
+	}
+	switch {
+	case m.loopsBack(i+2, r2, 2):
+		return r1, d1, r2, d2, true
+	case m.loopsBack(i+2, r1, 2):
+		return r2, d2, r1, d1, true
+	}
+	return 0, 0, 0, 0, false
+}
+
+// match returns the macro for a loop starting at instruction i, if any.
+func (m *Machine) match(i int) macro {
+	if mul := m.mulLoop(i); mul != nil {
+		return mul
+	}
+	x, dx, y, dy, ok := m.addLoop(i)
+	if !ok {
+		return nil
+	}
+	return func(m *Machine) bool {
+		n, ok := iterations(m.Regs[y], dy)
+		if !ok {
+			return false
+		}
+		m.Regs[x] += dx * n
+		m.Regs[y] = 0
+		m.IP = i + 3
+		m.Steps += 3 * n
+		return true
+	}
+}
+
+// mulLoop matches
+//
+//	cpy s t
+//	inc x   \
+//	dec t    } an add loop counting t down
+//	jnz t -2 /
+//	dec o
+//	jnz o -5
+//
+// which adds s*o to x and clears t and o.
+func (m *Machine) mulLoop(i int) macro {
+	if i+maxMacroLen > len(m.Program) {
+		return nil
+	}
+	cpy := m.Program[i]
+	if m.decoded[i].exec == nil || cpy.Op != "cpy" || !cpy.Args[1].IsReg {
+		return nil
+	}
+	src, t := cpy.Args[0], cpy.Args[1].Reg
+	x, dx, counter, dt, ok := m.addLoop(i + 1)
+	if !ok || counter != t {
+		return nil
+	}
+	o, do, ok := m.step(i + 4)
+	if !ok || o == t || o == x || !m.loopsBack(i+5, o, 5) {
+		return nil
+	}
+	if src.IsReg && (src.Reg == t || src.Reg == x || src.Reg == o) {
+		return nil
+	}
+	return func(m *Machine) bool {
+		inner, ok := iterations(m.Value(src), dt)
+		if !ok {
+			return false
+		}
+		outer, ok := iterations(m.Regs[o], do)
+		if !ok {
+			return false
+		}
+		m.Regs[x] += dx * inner * outer
+		m.Regs[t] = 0
+		m.Regs[o] = 0
+		m.IP = i + 6
+		m.Steps += outer * (3*inner + 3)
+		return true
+	}
+}
+
+// rematch recomputes the macros that could include instruction i.
+func (m *Machine) rematch(i int) {
+	for start := i - maxMacroLen + 1; start <= i; start++ {
+		if start >= 0 && start < len(m.Program) {
+			m.macros[start] = m.match(start)
+		}
+	}
+}
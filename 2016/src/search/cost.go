@@ -0,0 +1,98 @@
+package search
+
+import "container/heap"
+
+type queue[K comparable] []*node[K]
+
+func (q queue[K]) Len() int            { return len(q) }
+func (q queue[K]) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q queue[K]) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue[K]) Push(x interface{}) { *q = append(*q, x.(*node[K])) }
+func (q *queue[K]) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// Dijkstra finds a path with the least total cost, returning false if no
+// goal state is reachable.
+func Dijkstra[K comparable](start State[K]) (Result[K], bool) {
+	return AStar(start, nil)
+}
+
+// AStar is Dijkstra guided by a heuristic, which must never overestimate
+// the cost from a state to the nearest goal. A nil heuristic is always 0.
+func AStar[K comparable](start State[K], heuristic func(s State[K]) int) (Result[K], bool) {
+	h := func(s State[K]) int {
+		if heuristic == nil {
+			return 0
+		}
+		return heuristic(s)
+	}
+
+	// Nodes are queued by cost plus heuristic; best holds the plain cost.
+	best := map[K]int{start.Key(): 0}
+	q := &queue[K]{{state: start, cost: h(start)}}
+	expanded := 0
+	for q.Len() > 0 {
+		n := heap.Pop(q).(*node[K])
+		k := n.state.Key()
+		cost := n.cost - h(n.state)
+		if cost > best[k] {
+			continue
+		}
+		if n.state.Win() {
+			r := n.result(expanded)
+			r.Cost = cost
+			return r, true
+		}
+		expanded++
+		for _, m := range n.state.Moves() {
+			next := cost + m.Cost
+			mk := m.To.Key()
+			if b, ok := best[mk]; ok && b <= next {
+				continue
+			}
+			best[mk] = next
+			heap.Push(q, &node[K]{m.To, n, next + h(m.To)})
+		}
+	}
+	return Result[K]{Expanded: expanded}, false
+}
+
+// Longest finds the path with the greatest total cost to a goal state,
+// visiting each state at most once per path. It explores every such path,
+// so is only practical on small or acyclic spaces.
+func Longest[K comparable](start State[K]) (Result[K], bool) {
+	var best *node[K]
+	onPath := make(map[K]bool)
+	expanded := 0
+
+	var visit func(n *node[K])
+	visit = func(n *node[K]) {
+		if n.state.Win() {
+			if best == nil || n.cost > best.cost {
+				best = n
+			}
+			return
+		}
+		k := n.state.Key()
+		onPath[k] = true
+		expanded++
+		for _, m := range n.state.Moves() {
+			if !onPath[m.To.Key()] {
+				visit(&node[K]{m.To, n, n.cost + m.Cost})
+			}
+		}
+		delete(onPath, k)
+	}
+	visit(&node[K]{state: start})
+
+	if best == nil {
+		return Result[K]{Expanded: expanded}, false
+	}
+	r := best.result(expanded)
+	r.Cost = best.cost
+	return r, true
+}
@@ -0,0 +1,110 @@
+// Package search finds paths through state spaces: shortest by number of
+// moves (BFS), by total cost (Dijkstra, or A* given a heuristic), or
+// longest (exhaustive DFS).
+package search
+
+// State is a position in a search space. States with equal keys are treated
+// as the same state, so a key can fold together states that are
+// equivalent, as well as making states usable as map keys.
+type State[K comparable] interface {
+	Key() K
+	// Win reports whether this is a goal state. The search never moves on
+	// from a goal state.
+	Win() bool
+	Moves() []Move[K]
+}
+
+// Move leads to another state. BFS ignores Cost; the other searches need it
+// to be non-negative.
+type Move[K comparable] struct {
+	To   State[K]
+	Cost int
+}
+
+// Result is a path from the start state to a goal state.
+type Result[K comparable] struct {
+	Path []State[K]
+	Cost int
+	// Expanded counts the states whose moves the search looked at.
+	Expanded int
+}
+
+// Moves is the number of moves along the path.
+func (r Result[K]) Moves() int {
+	return len(r.Path) - 1
+}
+
+// Last is the goal state at the end of the path.
+func (r Result[K]) Last() State[K] {
+	return r.Path[len(r.Path)-1]
+}
+
+// node is a state reached during a search, with how it was reached.
+type node[K comparable] struct {
+	state State[K]
+	prev  *node[K]
+	cost  int
+}
+
+func (n *node[K]) result(expanded int) Result[K] {
+	var path []State[K]
+	for ; n != nil; n = n.prev {
+		path = append(path, n.state)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return Result[K]{path, 0, expanded}
+}
+
+// BFS finds a path with the fewest moves, returning false if no goal state
+// is reachable.
+func BFS[K comparable](start State[K]) (Result[K], bool) {
+	seen := map[K]bool{start.Key(): true}
+	queue := []*node[K]{{state: start}}
+	expanded := 0
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.state.Win() {
+			r := n.result(expanded)
+			r.Cost = r.Moves()
+			return r, true
+		}
+		expanded++
+		for _, m := range n.state.Moves() {
+			k := m.To.Key()
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			queue = append(queue, &node[K]{state: m.To, prev: n})
+		}
+	}
+	return Result[K]{Expanded: expanded}, false
+}
+
+// Reachable returns the fewest moves to each state within maxMoves of the
+// start, or every reachable state if maxMoves is negative. It moves on from
+// goal states like any other.
+func Reachable[K comparable](start State[K], maxMoves int) map[K]int {
+	dist := map[K]int{start.Key(): 0}
+	queue := []State[K]{start}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		d := dist[s.Key()]
+		if d == maxMoves {
+			continue
+		}
+		for _, m := range s.Moves() {
+			k := m.To.Key()
+			if _, ok := dist[k]; ok {
+				continue
+			}
+			dist[k] = d + 1
+			queue = append(queue, m.To)
+		}
+	}
+	return dist
+}
@@ -4,94 +4,74 @@ import (
 	"flag"
 	"fmt"
 	"knot"
+	"os"
 )
 
 var input = flag.String("input", "flqrgnkx", "The input to use.")
+var engine = flag.String("engine", "array", "Which knot hash implementation to use: ring or array.")
+var crossCheck = flag.Bool("crossCheck", false, "Whether to check that both knot hash engines agree on every row. Run the knot benchmarks to compare their speed.")
+var size = flag.Int("size", 128, "The width and height of the grid. Rows wider than 128 squares continue with the hashes of \"input-row-1\", \"input-row-2\" and so on, which is not part of the puzzle.")
+var verbose = flag.Bool("verbose", false, "Whether to list every region's size and bounding box.")
+var ascii = flag.Bool("ascii", false, "Whether to print the grid with each region drawn in its own character.")
+var pngFile = flag.String("png", "", "If set, file to write an image of the labeled regions to.")
 
 func main() {
 	flag.Parse()
 
-	set := 0
-	var bitField [128][128]bool
-	for i := 0; i < 128; i++ {
-		key := fmt.Sprintf("%s-%d", *input, i)
-		r := knot.Densify(knot.Hash(256, 64, knot.Key(key)))
-		bitField[i] = toBits(r)
-		set += countBits(bitField[i])
+	if *crossCheck {
+		checkEngines()
+		return
 	}
 
-	fmt.Printf("Found %d set bits.\n", set)
-
-	var addedToRegions [128][128]bool
-
-	regions := 0
-	for i := 0; i < 128; i++ {
-		for j := 0; j < 128; j++ {
-			if addedToRegions[i][j] || !bitField[i][j] {
-				// Only consider as seeds set tiles that are not part of regions.
-				continue
-			}
-			regions++
-			expandRegion(i, j, &bitField, &addedToRegions)
-		}
+	if *size < 1 {
+		fmt.Printf("Grid size must be positive, got %d.\n", *size)
+		return
 	}
-	fmt.Printf("Found %d non-overlapping regions.\n", regions)
-}
 
-func expandRegion(x, y int, bits, used *[128][128]bool) {
-	used[x][y] = true
-	// Try to expand up, down, left, and right.
-	if x > 0 && bits[x-1][y] && !used[x-1][y] {
-		expandRegion(x-1, y, bits, used)
-	}
-	if x < 127 && bits[x+1][y] && !used[x+1][y] {
-		expandRegion(x+1, y, bits, used)
-	}
-	if y > 0 && bits[x][y-1] && !used[x][y-1] {
-		expandRegion(x, y-1, bits, used)
+	e := knot.ArrayEngine
+	switch *engine {
+	case "array":
+	case "ring":
+		e = knot.RingEngine
+	default:
+		fmt.Printf("Unknown engine %q.\n", *engine)
+		return
 	}
-	if y < 127 && bits[x][y+1] && !used[x][y+1] {
-		expandRegion(x, y+1, bits, used)
-	}
-}
 
-func toBits(d []int) [128]bool {
-	var ret [128]bool
-	for j, v := range d {
-		lower := v & 15
-		upper := v >> 4
+	grid := e.Grid(*input, *size)
+	fmt.Printf("Found %d set bits.\n", grid.Count())
 
-		ret[8*j+0] = upper&8 > 0
-		ret[8*j+1] = upper&4 > 0
-		ret[8*j+2] = upper&2 > 0
-		ret[8*j+3] = upper&1 > 0
+	labels := grid.Label()
+	fmt.Printf("Found %d non-overlapping regions.\n", len(labels.Regions))
 
-		ret[8*j+4] = lower&8 > 0
-		ret[8*j+5] = lower&4 > 0
-		ret[8*j+6] = lower&2 > 0
-		ret[8*j+7] = lower&1 > 0
+	if *verbose {
+		for _, r := range labels.Regions {
+			fmt.Printf("Region %d: %d squares within (%d,%d)-(%d,%d)\n", r.Label, r.Size, r.MinX, r.MinY, r.MaxX, r.MaxY)
+		}
 	}
-	return ret
-}
-
-func display(array [128]bool) string {
-	ret := ""
-	for _, v := range array {
-		if v {
-			ret += "#"
-		} else {
-			ret += "."
+	if *ascii {
+		fmt.Print(labels.ASCII())
+	}
+	if *pngFile != "" {
+		f, err := os.Create(*pngFile)
+		if err != nil {
+			fmt.Printf("Failed to create %s: %v\n", *pngFile, err)
+			return
+		}
+		defer f.Close()
+		if err := labels.WritePNG(f, 4); err != nil {
+			fmt.Printf("Failed to write %s: %v\n", *pngFile, err)
 		}
 	}
-	return ret
 }
 
-func countBits(array [128]bool) int {
-	ret := 0
-	for _, v := range array {
-		if v {
-			ret++
+func checkEngines() {
+	for i := 0; i < 128; i++ {
+		key := knot.Key(fmt.Sprintf("%s-%d", *input, i))
+		if err := knot.CrossCheck(256, 64, key); err != nil {
+			fmt.Printf("Row %d: %v\n", i, err)
+			return
 		}
 	}
-	return ret
+	fmt.Println("Both engines agree on every row.")
 }
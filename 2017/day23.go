@@ -1,171 +1,119 @@
 package main
 
 import (
+	"duet"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"strconv"
-	"strings"
+	"os"
 )
 
 var inputFile = flag.String("inputFile", "inputs/day23.input", "Relative file path to use as input.")
 var partB = flag.Bool("partB", false, "Use Part B logic.")
-
-type Machine struct {
-	Ip        int
-	Id        int
-	Program   []Instruction
-	Registers map[byte]int
-}
-
-type Instruction func(*Machine)
+var profile = flag.Bool("profile", false, "Print how often each instruction ran and the hottest loops.")
+var b = flag.Int("b", -1, "If non-negative, override register b once the program has set it up.")
+var c = flag.Int("c", -1, "If non-negative, override register c once the program has set it up.")
+var verify = flag.Bool("verify", false, "Check register h against the hand-optimised composite count.")
 
 func main() {
 	flag.Parse()
 
-	bytes, err := ioutil.ReadFile(*inputFile)
+	f, err := os.Open(*inputFile)
 	if err != nil {
 		fmt.Printf("Could not open file %s because %v.\n", *inputFile, err)
+		return
+	}
+	defer f.Close()
+	p, err := duet.Parse(f, duet.Instructions)
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
 	}
-	contents := string(bytes)
-	instructions := strings.Split(contents[:len(contents)-1], "\n")
 
-	m := Machine{0, 0, make([]Instruction, len(instructions)), make(map[byte]int)}
-	for idx, inst := range instructions {
-		var f Instruction
+	// Count calls to mul by wrapping it.
+	muls := 0
+	mul := duet.Instructions["mul"]
+	counted := mul
+	counted.Exec = func(m *duet.Machine, args []duet.Operand) {
+		muls++
+		mul.Exec(m, args)
+	}
+	set := duet.Instructions.With(duet.InstructionSet{"mul": counted})
 
-		var secondOperand byte
-		if len(inst) >= 7 {
-			secondOperand = inst[6]
-		}
+	m := duet.New(p, set, duet.NoIO{})
+	if *partB {
+		m.SetRegister('a', 1)
+	}
 
-		switch inst[0:3] {
-		case "set":
-			operands := strings.Split(inst[4:], " ")
-			if lit, err := strconv.Atoi(operands[1]); err != nil {
-				f = func(m *Machine) {
-					r := m.Registers
-					i := &m.Ip
-					r[operands[0][0]] = r[secondOperand]
-					*i++
-				}
-			} else {
-				f = func(m *Machine) {
-					r := m.Registers
-					i := &m.Ip
-					r[operands[0][0]] = lit
-					*i++
-				}
-			}
-		case "sub":
-			operands := strings.Split(inst[4:], " ")
-			if lit, err := strconv.Atoi(operands[1]); err != nil {
-				f = func(m *Machine) {
-					r := m.Registers
-					i := &m.Ip
-					r[operands[0][0]] -= r[secondOperand]
-					*i++
-				}
-			} else {
-				f = func(m *Machine) {
-					r := m.Registers
-					i := &m.Ip
-					r[operands[0][0]] -= lit
-					*i++
-				}
-			}
-		case "mul":
-			operands := strings.Split(inst[4:], " ")
-			if lit, err := strconv.Atoi(operands[1]); err != nil {
-				f = func(m *Machine) {
-					r := m.Registers
-					i := &m.Ip
-					r['m']++
-					r[operands[0][0]] *= r[secondOperand]
-					*i++
-				}
-			} else {
-				f = func(m *Machine) {
-					r := m.Registers
-					i := &m.Ip
-					r['m']++
-					r[operands[0][0]] *= lit
-					*i++
-				}
-			}
-		case "jnz":
-			operands := strings.Split(inst[4:], " ")
-			if comparator, err := strconv.Atoi(operands[0]); err != nil {
-				// Just use the 0 letter of the 0th operand
-				if lit, err := strconv.Atoi(operands[1]); err != nil {
-					f = func(m *Machine) {
-						r := m.Registers
-						i := &m.Ip
-						offset := r[operands[1][0]]
-						if r[operands[0][0]] != 0 {
-							*i += offset
-						} else {
-							*i++
-						}
-					}
-				} else {
-					f = func(m *Machine) {
-						r := m.Registers
-						i := &m.Ip
-						offset := lit
-						if r[operands[0][0]] != 0 {
-							*i += offset
-						} else {
-							*i++
-						}
-					}
-				}
-			} else {
-				// Use the parsed comparator literal value.
-				if lit, err := strconv.Atoi(operands[1]); err != nil {
-					f = func(m *Machine) {
-						r := m.Registers
-						i := &m.Ip
-						offset := r[operands[1][0]]
-						if comparator != 0 {
-							*i += offset
-						} else {
-							*i++
-						}
-					}
-				} else {
-					f = func(m *Machine) {
-						i := &m.Ip
-						offset := lit
-						if comparator != 0 {
-							*i += offset
-						} else {
-							*i++
-						}
-					}
-				}
-			}
-		default:
-			fmt.Printf("Unrecognized instruction %s\n", inst)
+	if *b >= 0 || *c >= 0 || *verify {
+		head, ok := outerLoop(p)
+		if !ok {
+			fmt.Printf("Can't find the outer loop where b and c are set up.\n")
+			return
+		}
+		for m.IP != head && m.Step() {
+		}
+		if *b >= 0 {
+			m.SetRegister('b', *b)
+		}
+		if *c >= 0 {
+			m.SetRegister('c', *c)
+		}
+		if (m.Register('c')-m.Register('b'))%17 != 0 || m.Register('c') < m.Register('b') {
+			fmt.Printf("c-b must be a non-negative multiple of 17, or the program never finishes.\n")
 			return
 		}
-		m.Program[idx] = f
 	}
+	from, to := m.Register('b'), m.Register('c')
 
-	if *partB {
-		m.Registers['a'] = 1
+	m.Profiling = *profile
+	m.Run(0)
+	if m.Err != nil {
+		fmt.Printf("Program failed: %v\n", m.Err)
+		return
 	}
+	fmt.Printf("Out of bounds, terminating.\n")
+	fmt.Printf("Mul was called %d times.\n", muls)
+	fmt.Printf("Register h is %d.\n", m.Register('h'))
 
-	m.Run()
-	fmt.Printf("Mul was called %d times.\n", m.Registers['m'])
+	if *profile {
+		prof := m.Profile()
+		fmt.Printf("\n%s\nHottest loops:\n%s", prof.Listing(), prof.HotLoops(5))
+	}
+	if *verify {
+		want := composites(from, to)
+		fmt.Printf("Counting composites from %d to %d gives %d: ", from, to, want)
+		if want == m.Register('h') {
+			fmt.Printf("matches.\n")
+		} else {
+			fmt.Printf("MISMATCH.\n")
+		}
+	}
+}
+
+// outerLoop returns the start of the loop closed by an unconditional jump
+// at the end of the program, which is where b and c have been set up.
+func outerLoop(p duet.Program) (int, bool) {
+	if len(p) == 0 {
+		return 0, false
+	}
+	last := p[len(p)-1]
+	if last.Op != "jnz" || last.Args[0].IsReg || last.Args[0].Val == 0 || last.Args[1].IsReg || last.Args[1].Val >= 0 {
+		return 0, false
+	}
+	return len(p) - 1 + last.Args[1].Val, true
 }
 
-func (m *Machine) Run() {
-	for {
-		if m.Ip >= len(m.Program) || m.Ip < 0 {
-			fmt.Printf("Out of bounds, terminating.\n")
-			break
+// composites is day23b's hand optimisation of part B: it counts the
+// composite numbers in b, b+17, ..., c.
+func composites(b, c int) int {
+	count := 0
+	for ; b <= c; b += 17 {
+		for d := 2; d*d <= b; d++ {
+			if b%d == 0 {
+				count++
+				break
+			}
 		}
-		m.Program[m.Ip](m)
 	}
+	return count
 }
@@ -0,0 +1,109 @@
+// Package duet is the 2017 register machine shared by days 18 and 23.
+package duet
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Operand is a register a-z or a literal.
+type Operand struct {
+	IsReg bool
+	Reg   int // 0 for a through 25 for z.
+	Val   int
+}
+
+func (o Operand) String() string {
+	if o.IsReg {
+		return string(rune('a' + o.Reg))
+	}
+	return strconv.Itoa(o.Val)
+}
+
+type Instruction struct {
+	Op   string
+	Args []Operand
+}
+
+func (i Instruction) String() string {
+	parts := []string{i.Op}
+	for _, a := range i.Args {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+type Program []Instruction
+
+// Op moves IP itself; Target lists operands that must be registers.
+type Op struct {
+	Arity  int
+	Target []int
+	Exec   func(m *Machine, args []Operand)
+}
+
+// InstructionSet maps instruction names to their implementations.
+type InstructionSet map[string]Op
+
+func arith(f func(x, y int) int) Op {
+	return Op{2, []int{0}, func(m *Machine, args []Operand) {
+		r := &m.Registers[args[0].Reg]
+		*r = f(*r, m.Value(args[1]))
+		m.IP++
+	}}
+}
+
+func jump(cond func(x int) bool) Op {
+	return Op{2, nil, func(m *Machine, args []Operand) {
+		if cond(m.Value(args[0])) {
+			m.IP += m.Value(args[1])
+		} else {
+			m.IP++
+		}
+	}}
+}
+
+// Instructions covers both days; snd and rcv go through the machine's IO.
+var Instructions = InstructionSet{
+	"set": arith(func(_, y int) int { return y }),
+	"add": arith(func(x, y int) int { return x + y }),
+	"sub": arith(func(x, y int) int { return x - y }),
+	"mul": arith(func(x, y int) int { return x * y }),
+	"mod": {2, []int{0}, func(m *Machine, args []Operand) {
+		y := m.Value(args[1])
+		if y == 0 {
+			m.fail("mod by zero")
+			return
+		}
+		m.Registers[args[0].Reg] %= y
+		m.IP++
+	}},
+	"jgz": jump(func(x int) bool { return x > 0 }),
+	"jnz": jump(func(x int) bool { return x != 0 }),
+	"snd": {1, nil, func(m *Machine, args []Operand) {
+		m.IO.Send(m, m.Value(args[0]))
+		m.Sent++
+		m.IP++
+	}},
+	"rcv": {1, []int{0}, func(m *Machine, args []Operand) {
+		if m.IO.Receive(m, args[0].Reg) {
+			m.Waiting = false
+			m.Received++
+			m.IP++
+		} else {
+			m.Waiting = true
+		}
+	}},
+}
+
+// With overlays other on a copy of s.
+func (s InstructionSet) With(other InstructionSet) InstructionSet {
+	ret := make(InstructionSet, len(s)+len(other))
+	for k, v := range s {
+		ret[k] = v
+	}
+	for k, v := range other {
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package duet
+
+// Sound is day 18's first reading of the instructions: snd plays a sound
+// and rcv recovers the last one played if its operand is non-zero.
+type Sound struct {
+	Last      int
+	Recovered []int
+	// StopOnRecover stops the machine at the first recovery.
+	StopOnRecover bool
+}
+
+func (s *Sound) Send(m *Machine, v int) {
+	s.Last = v
+}
+
+func (s *Sound) Receive(m *Machine, reg int) bool {
+	if m.Registers[reg] != 0 {
+		s.Recovered = append(s.Recovered, s.Last)
+		if s.StopOnRecover {
+			m.Stopped = true
+		}
+	}
+	return true
+}
+
+// NoIO is for programs that shouldn't use snd or rcv; either one stops the
+// machine with an error.
+type NoIO struct{}
+
+func (NoIO) Send(m *Machine, v int) {
+	m.fail("snd with no IO")
+}
+
+func (NoIO) Receive(m *Machine, reg int) bool {
+	m.fail("rcv with no IO")
+	return false
+}
+
+// Queue is a first-in, first-out queue of values.
+type Queue struct {
+	values []int
+}
+
+func (q *Queue) Push(v int) {
+	q.values = append(q.values, v)
+}
+
+// Pop removes the oldest value, returning false if there is none.
+func (q *Queue) Pop() (int, bool) {
+	if len(q.values) == 0 {
+		return 0, false
+	}
+	v := q.values[0]
+	q.values = q.values[1:]
+	return v, true
+}
+
+func (q *Queue) Len() int {
+	return len(q.values)
+}
+
+// Messages is day 18's second reading: snd sends a value to other
+// programs and rcv waits for one to arrive.
+type Messages struct {
+	In  *Queue
+	Out []*Queue
+}
+
+func (q *Messages) Send(m *Machine, v int) {
+	for _, out := range q.Out {
+		out.Push(v)
+	}
+}
+
+func (q *Messages) Receive(m *Machine, reg int) bool {
+	v, ok := q.In.Pop()
+	if !ok {
+		return false
+	}
+	m.Registers[reg] = v
+	return true
+}
@@ -0,0 +1,115 @@
+package duet
+
+import "fmt"
+
+// IO decides what snd and rcv mean.
+type IO interface {
+	// Send handles snd with the value v.
+	Send(m *Machine, v int)
+	// Receive returns false to block until a later Step.
+	Receive(m *Machine, reg int) bool
+}
+
+type decoded struct {
+	exec func(m *Machine, args []Operand)
+	args []Operand
+}
+
+type Machine struct {
+	ID        int
+	IP        int
+	Program   Program
+	Registers [26]int
+	IO        IO
+	Steps     int
+	// Sent and Received count the snd and completed rcv instructions.
+	Sent, Received int
+	// Waiting is set while the machine is blocked on a rcv.
+	Waiting bool
+	Stopped bool
+	// Err is why the machine stopped itself, if it did.
+	Err error
+	// Trace is called before each instruction.
+	Trace func(m *Machine)
+	// Profiling records what Profile reports.
+	Profiling bool
+	// Hits is indexed by instruction.
+	Hits []int
+
+	decoded   []decoded
+	backEdges map[[2]int]int
+}
+
+// New returns a machine at the start of p; a nil io means NoIO.
+func New(p Program, set InstructionSet, io IO) *Machine {
+	if io == nil {
+		io = NoIO{}
+	}
+	m := &Machine{Program: p, IO: io, decoded: make([]decoded, len(p))}
+	for i, in := range p {
+		m.decoded[i] = decoded{set[in.Op].Exec, in.Args}
+	}
+	return m
+}
+
+// Register returns the contents of the register with the given name.
+func (m *Machine) Register(name byte) int {
+	return m.Registers[name-'a']
+}
+
+// SetRegister sets the register with the given name.
+func (m *Machine) SetRegister(name byte, v int) {
+	m.Registers[name-'a'] = v
+}
+
+// Value reads a register operand or returns a literal.
+func (m *Machine) Value(o Operand) int {
+	if o.IsReg {
+		return m.Registers[o.Reg]
+	}
+	return o.Val
+}
+
+// Halted is true once IP runs off either end or Stopped is set.
+func (m *Machine) Halted() bool {
+	return m.Stopped || m.IP < 0 || m.IP >= len(m.Program)
+}
+
+// fail stops the machine with an error about the current instruction.
+func (m *Machine) fail(msg string) {
+	m.Err = fmt.Errorf("instruction %d (%s): %s", m.IP, m.Program[m.IP], msg)
+	m.Stopped = true
+}
+
+// Step reports false when halted or blocked on rcv.
+func (m *Machine) Step() bool {
+	if m.Halted() {
+		return false
+	}
+	if m.Trace != nil {
+		m.Trace(m)
+	}
+	ip := m.IP
+	d := m.decoded[ip]
+	d.exec(m, d.args)
+	if m.Waiting || m.Err != nil {
+		return false
+	}
+	m.Steps++
+	if m.Profiling {
+		m.record(ip)
+	}
+	return true
+}
+
+// Run steps until Step fails, at most maxSteps times if that is positive,
+// and returns the count.
+func (m *Machine) Run(maxSteps int) int {
+	steps := 0
+	for ; maxSteps <= 0 || steps < maxSteps; steps++ {
+		if !m.Step() {
+			break
+		}
+	}
+	return steps
+}
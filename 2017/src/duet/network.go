@@ -0,0 +1,71 @@
+package duet
+
+import "fmt"
+
+// Topology decides who hears each program's snd.
+type Topology struct {
+	Name string
+	// Peers returns the ids that program id sends to, in a network of n.
+	Peers func(id, n int) []int
+	// Valid reports whether the topology works for n programs.
+	Valid func(n int) bool
+}
+
+var (
+	// Ring sends to the next program along, wrapping around.
+	Ring = Topology{"ring",
+		func(id, n int) []int { return []int{(id + 1) % n} },
+		func(n int) bool { return n >= 1 }}
+	// Pairwise wires 0 with 1, 2 with 3 and so on, as in day 18.
+	Pairwise = Topology{"pairwise",
+		func(id, n int) []int { return []int{id ^ 1} },
+		func(n int) bool { return n >= 2 && n%2 == 0 }}
+	// Broadcast sends to every other program.
+	Broadcast = Topology{"broadcast",
+		func(id, n int) []int {
+			var ret []int
+			for i := 0; i < n; i++ {
+				if i != id {
+					ret = append(ret, i)
+				}
+			}
+			return ret
+		},
+		func(n int) bool { return n >= 2 }}
+)
+
+var Topologies = []Topology{Ring, Pairwise, Broadcast}
+
+// ParseTopology returns the topology with the given name.
+func ParseTopology(name string) (Topology, error) {
+	for _, t := range Topologies {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return Topology{}, fmt.Errorf("unknown topology %q", name)
+}
+
+// NewNetwork returns a scheduler running n copies of p wired together by t.
+// Each program gets its own id in register p.
+func NewNetwork(p Program, set InstructionSet, n int, t Topology) (*Scheduler, error) {
+	if !t.Valid(n) {
+		return nil, fmt.Errorf("%s topology can't connect %d programs", t.Name, n)
+	}
+	inboxes := make([]*Queue, n)
+	for i := range inboxes {
+		inboxes[i] = &Queue{}
+	}
+	machines := make([]*Machine, n)
+	for i := range machines {
+		io := &Messages{In: inboxes[i]}
+		for _, peer := range t.Peers(i, n) {
+			io.Out = append(io.Out, inboxes[peer])
+		}
+		m := New(p, set, io)
+		m.ID = i
+		m.SetRegister('p', i)
+		machines[i] = m
+	}
+	return NewScheduler(machines...), nil
+}
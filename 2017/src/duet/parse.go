@@ -0,0 +1,61 @@
+package duet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Parse reads one instruction per line.
+func Parse(in io.Reader, set InstructionSet) (Program, error) {
+	var p Program
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		op, ok := set[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown instruction %q", line, fields[0])
+		}
+		if len(fields)-1 != op.Arity {
+			return nil, fmt.Errorf("line %d: %s takes %d operands, got %d", line, fields[0], op.Arity, len(fields)-1)
+		}
+		in := Instruction{Op: fields[0]}
+		for _, f := range fields[1:] {
+			o, err := parseOperand(f)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			in.Args = append(in.Args, o)
+		}
+		for _, t := range op.Target {
+			if !in.Args[t].IsReg {
+				return nil, fmt.Errorf("line %d: operand %d of %s must be a register", line, t+1, fields[0])
+			}
+		}
+		p = append(p, in)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ParseString is Parse on a string.
+func ParseString(s string, set InstructionSet) (Program, error) {
+	return Parse(strings.NewReader(s), set)
+}
+
+func parseOperand(s string) (Operand, error) {
+	if v, err := strconv.Atoi(s); err == nil {
+		return Operand{Val: v}, nil
+	}
+	if len(s) == 1 && s[0] >= 'a' && s[0] <= 'z' {
+		return Operand{IsReg: true, Reg: int(s[0] - 'a')}, nil
+	}
+	return Operand{}, fmt.Errorf("bad operand %q", s)
+}
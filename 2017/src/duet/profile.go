@@ -0,0 +1,88 @@
+package duet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// record notes that the instruction at ip just ran.
+func (m *Machine) record(ip int) {
+	if m.Hits == nil {
+		m.Hits = make([]int, len(m.Program))
+		m.backEdges = make(map[[2]int]int)
+	}
+	m.Hits[ip]++
+	if m.IP <= ip && m.IP >= 0 {
+		m.backEdges[[2]int{m.IP, ip}]++
+	}
+}
+
+// Loop is the stretch of instructions [Start, End] repeated by a backward
+// jump at End. Iterations counts how often the jump was taken and Steps the
+// instructions run inside the loop, including those of nested loops.
+type Loop struct {
+	Start, End int
+	Iterations int
+	Steps      int
+}
+
+// Profile summarises where a profiling machine spent its time.
+type Profile struct {
+	Program Program
+	Hits    []int
+	Total   int
+	// Loops is ordered by Steps, hottest first.
+	Loops []Loop
+}
+
+// Profile returns what the machine has recorded since Profiling was set.
+func (m *Machine) Profile() Profile {
+	p := Profile{Program: m.Program, Hits: make([]int, len(m.Program))}
+	copy(p.Hits, m.Hits)
+	for _, h := range p.Hits {
+		p.Total += h
+	}
+	for edge, n := range m.backEdges {
+		l := Loop{Start: edge[0], End: edge[1], Iterations: n}
+		for i := l.Start; i <= l.End; i++ {
+			l.Steps += p.Hits[i]
+		}
+		p.Loops = append(p.Loops, l)
+	}
+	sort.Slice(p.Loops, func(i, j int) bool {
+		if p.Loops[i].Steps != p.Loops[j].Steps {
+			return p.Loops[i].Steps > p.Loops[j].Steps
+		}
+		return p.Loops[i].Start < p.Loops[j].Start
+	})
+	return p
+}
+
+func (p Profile) percent(n int) float64 {
+	if p.Total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(p.Total)
+}
+
+// Listing returns the program annotated with hit counts.
+func (p Profile) Listing() string {
+	var b strings.Builder
+	for i, in := range p.Program {
+		fmt.Fprintf(&b, "%4d  %-12s %12d %6.2f%%\n", i, in, p.Hits[i], p.percent(p.Hits[i]))
+	}
+	return b.String()
+}
+
+// HotLoops describes the n loops that ran the most instructions.
+func (p Profile) HotLoops(n int) string {
+	var b strings.Builder
+	for i, l := range p.Loops {
+		if i == n {
+			break
+		}
+		fmt.Fprintf(&b, "%4d-%-4d %12d iterations %12d steps %6.2f%%\n", l.Start, l.End, l.Iterations, l.Steps, p.percent(l.Steps))
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package duet
+
+import "fmt"
+
+// Outcome is why a Scheduler stopped.
+type Outcome int
+
+const (
+	// RoundLimit means the scheduler ran out of rounds.
+	RoundLimit Outcome = iota
+	// AllHalted means no machine can run again.
+	AllHalted
+	// Deadlock means the live machines all wait on each other.
+	Deadlock
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case RoundLimit:
+		return "round limit"
+	case AllHalted:
+		return "all halted"
+	case Deadlock:
+		return "deadlock"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// Scheduler takes turns on one goroutine so runs are reproducible.
+type Scheduler struct {
+	Machines []*Machine
+	// Quantum caps each turn when positive.
+	Quantum int
+	Rounds  int
+}
+
+// DefaultQuantum stands in for an unset Quantum when rounds are limited, as
+// a machine that is never starved of input would otherwise never yield.
+const DefaultQuantum = 10000
+
+func NewScheduler(machines ...*Machine) *Scheduler {
+	return &Scheduler{Machines: machines}
+}
+
+// Run plays rounds until an Outcome is reached; maxRounds only counts if
+// positive. A round where nobody moves would repeat forever, hence Deadlock.
+func (s *Scheduler) Run(maxRounds int) Outcome {
+	quantum := s.Quantum
+	if maxRounds > 0 && quantum <= 0 {
+		quantum = DefaultQuantum
+	}
+	for rounds := 0; maxRounds <= 0 || rounds < maxRounds; rounds++ {
+		progress := 0
+		for _, m := range s.Machines {
+			progress += m.Run(quantum)
+		}
+		s.Rounds++
+		if progress > 0 {
+			continue
+		}
+		for _, m := range s.Machines {
+			if !m.Halted() {
+				return Deadlock
+			}
+		}
+		return AllHalted
+	}
+	return RoundLimit
+}
+
+// Stats describes one machine at the end of a run.
+type Stats struct {
+	ID             int
+	Steps          int
+	Sent, Received int
+	Halted         bool
+	Waiting        bool
+}
+
+func (st Stats) String() string {
+	state := "running"
+	switch {
+	case st.Halted:
+		state = "halted"
+	case st.Waiting:
+		state = "waiting"
+	}
+	return fmt.Sprintf("program %d: %s after %d steps, sent %d, received %d", st.ID, state, st.Steps, st.Sent, st.Received)
+}
+
+// Stats returns the state of every machine, in order.
+func (s *Scheduler) Stats() []Stats {
+	ret := make([]Stats, len(s.Machines))
+	for i, m := range s.Machines {
+		ret[i] = Stats{m.ID, m.Steps, m.Sent, m.Received, m.Halted(), m.Waiting && !m.Halted()}
+	}
+	return ret
+}
@@ -0,0 +1,75 @@
+package knot
+
+import "fmt"
+
+// Engine computes the sparse hash: the list of length elements after the
+// given rounds, starting from the list's original first position.
+type Engine func(length, rounds int, key []int) []int
+
+// RingEngine is the original container/ring implementation.
+var RingEngine Engine = func(length, rounds int, key []int) []int {
+	r := Hash(length, rounds, key)
+	ret := make([]int, length)
+	for i := range ret {
+		ret[i] = Get(r)
+		r = r.Next()
+	}
+	return ret
+}
+
+// ArrayEngine keeps the list in a slice and reverses spans in place,
+// wrapping around the end. It is what Sum and New use.
+var ArrayEngine Engine = Sparse
+
+// Sparse is the slice-based implementation behind ArrayEngine.
+func Sparse(length, rounds int, key []int) []int {
+	list := make([]int, length)
+	for i := range list {
+		list[i] = i
+	}
+	pos, skip := 0, 0
+	for r := 0; r < rounds; r++ {
+		for _, n := range key {
+			for i, j := pos, pos+n-1; i < j; i, j = i+1, j-1 {
+				a, b := i%length, j%length
+				list[a], list[b] = list[b], list[a]
+			}
+			pos = (pos + n + skip) % length
+			skip++
+		}
+	}
+	return list
+}
+
+// Dense XORs each run of 16 elements of a sparse hash together.
+func Dense(sparse []int) []int {
+	ret := make([]int, len(sparse)/16)
+	for i := range ret {
+		for _, v := range sparse[16*i : 16*(i+1)] {
+			ret[i] ^= v
+		}
+	}
+	return ret
+}
+
+// Sum returns the full knot hash of the input computed with this engine.
+func (e Engine) Sum(input string) [Size]byte {
+	var ret [Size]byte
+	for i, v := range Dense(e(256, 64, Key(input))) {
+		ret[i] = byte(v)
+	}
+	return ret
+}
+
+// CrossCheck runs the ring and array engines on the same key, returning an
+// error describing the first position where their sparse hashes differ.
+func CrossCheck(length, rounds int, key []int) error {
+	want := RingEngine(length, rounds, key)
+	got := ArrayEngine(length, rounds, key)
+	for i := range want {
+		if want[i] != got[i] {
+			return fmt.Errorf("engines differ at position %d: ring has %d, array has %d", i, want[i], got[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package knot
+
+import (
+	"fmt"
+	"testing"
+)
+
+var rows = func() []string {
+	ret := make([]string, 128)
+	for i := range ret {
+		ret[i] = fmt.Sprintf("flqrgnkx-%d", i)
+	}
+	return ret
+}()
+
+func TestCrossCheck(t *testing.T) {
+	for _, row := range rows {
+		if err := CrossCheck(256, 64, Key(row)); err != nil {
+			t.Errorf("%s: %v", row, err)
+		}
+	}
+}
+
+func benchmarkEngine(b *testing.B, e Engine) {
+	for n := 0; n < b.N; n++ {
+		for _, row := range rows {
+			e.Sum(row)
+		}
+	}
+}
+
+func BenchmarkRingEngine(b *testing.B) {
+	benchmarkEngine(b, RingEngine)
+}
+
+func BenchmarkArrayEngine(b *testing.B) {
+	benchmarkEngine(b, ArrayEngine)
+}
@@ -0,0 +1,56 @@
+package knot
+
+import (
+	"encoding/hex"
+	"hash"
+)
+
+// Size is the length of a dense knot hash in bytes.
+const Size = 16
+
+// digest buffers its input, since every round of the knot hash needs the
+// whole key.
+type digest struct {
+	buf []byte
+}
+
+// New returns a hash.Hash computing the full knot hash: 64 rounds over 256
+// elements, densified to 16 bytes.
+func New() hash.Hash {
+	return &digest{}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+	return len(p), nil
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	sum := Sum(string(d.buf))
+	return append(b, sum[:]...)
+}
+
+func (d *digest) Reset() {
+	d.buf = d.buf[:0]
+}
+
+func (d *digest) Size() int {
+	return Size
+}
+
+// BlockSize is 1: the knot hash has no notion of blocks, so any write size
+// is as good as any other.
+func (d *digest) BlockSize() int {
+	return 1
+}
+
+// Sum returns the knot hash of the input.
+func Sum(input string) [Size]byte {
+	return ArrayEngine.Sum(input)
+}
+
+// HexSum returns the knot hash of the input as 32 hexadecimal digits.
+func HexSum(input string) string {
+	sum := Sum(input)
+	return hex.EncodeToString(sum[:])
+}
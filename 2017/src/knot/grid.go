@@ -0,0 +1,168 @@
+package knot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Grid is a square disk where each square is used or free, built from the
+// bits of knot hashes.
+type Grid struct {
+	Size int
+	Used [][]bool
+}
+
+// NewGrid builds a size by size grid for the key using ArrayEngine.
+func NewGrid(key string, size int) *Grid {
+	return ArrayEngine.Grid(key, size)
+}
+
+// Grid builds a size by size grid for the key. Row r holds the bits of the
+// hash of "key-r", most significant first. Rows wider than one hash continue
+// with the hashes of "key-r-1", "key-r-2" and so on. It panics if size is
+// negative.
+func (e Engine) Grid(key string, size int) *Grid {
+	g := &Grid{Size: size, Used: make([][]bool, size)}
+	for r := range g.Used {
+		row := make([]bool, 0, size+8*Size)
+		for part := 0; len(row) < size; part++ {
+			input := fmt.Sprintf("%s-%d", key, r)
+			if part > 0 {
+				input = fmt.Sprintf("%s-%d", input, part)
+			}
+			for _, b := range e.Sum(input) {
+				for bit := 7; bit >= 0; bit-- {
+					row = append(row, b&(1<<uint(bit)) != 0)
+				}
+			}
+		}
+		g.Used[r] = row[:size]
+	}
+	return g
+}
+
+// Count returns the number of used squares.
+func (g *Grid) Count() int {
+	ret := 0
+	for _, row := range g.Used {
+		for _, v := range row {
+			if v {
+				ret++
+			}
+		}
+	}
+	return ret
+}
+
+// Region is a group of used squares connected horizontally or vertically.
+type Region struct {
+	Label      int
+	Size       int
+	MinX, MinY int
+	MaxX, MaxY int
+}
+
+// Labeling assigns every used square of a grid to a region. Labels[y][x] is
+// 0 for free squares and otherwise the 1-based index into Regions.
+type Labeling struct {
+	Labels  [][]int
+	Regions []Region
+}
+
+// Label finds the regions of the grid. It floods each region with an
+// explicit stack, so large grids can't overflow the call stack.
+func (g *Grid) Label() *Labeling {
+	l := &Labeling{Labels: make([][]int, g.Size)}
+	for y := range l.Labels {
+		l.Labels[y] = make([]int, g.Size)
+	}
+
+	type point struct{ x, y int }
+	var stack []point
+	for y := 0; y < g.Size; y++ {
+		for x := 0; x < g.Size; x++ {
+			if !g.Used[y][x] || l.Labels[y][x] != 0 {
+				continue
+			}
+			reg := Region{Label: len(l.Regions) + 1, MinX: x, MinY: y, MaxX: x, MaxY: y}
+			l.Labels[y][x] = reg.Label
+			stack = append(stack[:0], point{x, y})
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				reg.Size++
+				if p.x < reg.MinX {
+					reg.MinX = p.x
+				}
+				if p.x > reg.MaxX {
+					reg.MaxX = p.x
+				}
+				if p.y < reg.MinY {
+					reg.MinY = p.y
+				}
+				if p.y > reg.MaxY {
+					reg.MaxY = p.y
+				}
+				for _, n := range []point{{p.x - 1, p.y}, {p.x + 1, p.y}, {p.x, p.y - 1}, {p.x, p.y + 1}} {
+					if n.x < 0 || n.y < 0 || n.x >= g.Size || n.y >= g.Size {
+						continue
+					}
+					if g.Used[n.y][n.x] && l.Labels[n.y][n.x] == 0 {
+						l.Labels[n.y][n.x] = reg.Label
+						stack = append(stack, n)
+					}
+				}
+			}
+			l.Regions = append(l.Regions, reg)
+		}
+	}
+	return l
+}
+
+const regionChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// ASCII draws free squares as '.' and used ones with a character that
+// depends on their region; characters repeat once there are enough regions.
+func (l *Labeling) ASCII() string {
+	var b strings.Builder
+	for _, row := range l.Labels {
+		for _, v := range row {
+			if v == 0 {
+				b.WriteByte('.')
+			} else {
+				b.WriteByte(regionChars[(v-1)%len(regionChars)])
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// WritePNG draws each square as a scale by scale block, black if free and
+// otherwise in a colour derived from its region.
+func (l *Labeling) WritePNG(w io.Writer, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+	size := len(l.Labels)
+	img := image.NewRGBA(image.Rect(0, 0, size*scale, size*scale))
+	for y, row := range l.Labels {
+		for x, v := range row {
+			c := color.RGBA{0, 0, 0, 255}
+			if v != 0 {
+				// Spread neighbouring labels far apart in colour.
+				c = color.RGBA{uint8(64 + v*97%192), uint8(64 + v*57%192), uint8(64 + v*31%192), 255}
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.Set(x*scale+dx, y*scale+dy, c)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
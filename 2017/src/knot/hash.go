@@ -7,8 +7,8 @@ import (
 
 func Key(input string) []int {
 	ls := make([]int, len(input)+5)
-	for i, l := range input {
-		ls[i] = int(l)
+	for i := 0; i < len(input); i++ {
+		ls[i] = int(input[i])
 	}
 	addedLengths := [5]int{17, 31, 73, 47, 23}
 	for i := 0; i < len(addedLengths); i++ {
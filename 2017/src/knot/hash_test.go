@@ -0,0 +1,41 @@
+package knot
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	// Keys are taken byte by byte, so non-ASCII runes become their UTF-8
+	// encoding rather than code points that don't fit in a length.
+	want := []int{'a', 0xc3, 0xa9, 17, 31, 73, 47, 23}
+	if got := Key("aé"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Key(\"aé\") = %v, want %v", got, want)
+	}
+}
+
+func TestHexSum(t *testing.T) {
+	for input, want := range map[string]string{
+		"":         "a2582a3a0e66e6e86e3812dcb672a272",
+		"AoC 2017": "33efeb34ea91902bb2f59c9920caa6cd",
+		"1,2,3":    "3efbe78a8d82f29979031a4aa0b16a9d",
+		"1,2,4":    "63960835bcdc130f0b66d7ff4f6a5a8e",
+	} {
+		if got := HexSum(input); got != want {
+			t.Errorf("HexSum(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestNonASCIIKey(t *testing.T) {
+	const input = "flqrgnkx-ü€"
+	if err := CrossCheck(256, 64, Key(input)); err != nil {
+		t.Error(err)
+	}
+	d := New()
+	d.Write([]byte(input))
+	if got, want := fmt.Sprintf("%x", d.Sum(nil)), HexSum(input); got != want {
+		t.Errorf("digest of %q = %s, HexSum = %s", input, got, want)
+	}
+}
@@ -14,12 +14,10 @@ import (
 var inputFile = flag.String("inputFile", "inputs/day16.input", "Relative file path to use as input.")
 var verbose = flag.Bool("verbose", false, "Whether to print verbose output.")
 
-var regDiagram = regexp.MustCompile(".*:[ ]+\\[(\\d+), (\\d+), (\\d+), (\\d+)\\]")
-
-type Instruction [4]int
+// The samples and program only use four registers.
+const registers = 4
 
-type OpRegistry map[int]asm.Op
-type Ops []asm.Op
+var regDiagram = regexp.MustCompile(".*:[ ]+\\[(\\d+), (\\d+), (\\d+), (\\d+)\\]")
 
 func main() {
 	flag.Parse()
@@ -29,18 +27,11 @@ func main() {
 	}
 	defer f.Close()
 
-	ops := make(Ops, 0)
-	opN := make([]string, 0)
-	for k, v := range asm.AllOps {
-		opN = append(opN, k)
-		ops = append(ops, v)
-	}
-
 	reader := bufio.NewReader(f)
 	spaces := 0
 
 	lines := make([]string, 0)
-	instructions := make([]Instruction, 0)
+	code := make([][4]int, 0)
 	for {
 		l, err := reader.ReadString('\n')
 		if err != nil || len(l) == 0 {
@@ -57,113 +48,65 @@ func main() {
 			}
 			lines = append(lines, l)
 		} else {
-			rawInstr := strings.Split(l, " ")
-			var instr Instruction
-			for i := 0; i < 4; i++ {
-				instr[i], _ = strconv.Atoi(rawInstr[i])
-			}
-			instructions = append(instructions, instr)
+			code = append(code, parseInstruction(l))
 		}
 	}
 
-	// Map observed opcodes to possible ops[i] indices.
-	candidates := make(map[int]map[int]bool)
-
+	samples := make([]asm.Sample, 0)
 	multimatches := 0
-	for ln := 0; ln+4 < len(lines); {
-		// Parse the before.
-		before := regDiagram.FindStringSubmatch(lines[ln])[1:5]
-		var rb asm.Registers
-		for i := 0; i < 4; i++ {
-			rb[i], _ = strconv.Atoi(before[i])
-		}
-
-		// Parse the instruction.
-		ln++
-		rawInstr := strings.Split(lines[ln], " ")
-		var instr Instruction
-		for i := 0; i < 4; i++ {
-			instr[i], _ = strconv.Atoi(rawInstr[i])
-		}
-
-		// Parse the after.
-		ln++
-		after := regDiagram.FindStringSubmatch(lines[ln])[1:5]
-		var ra asm.Registers
-		for i := 0; i < 4; i++ {
-			ra[i], _ = strconv.Atoi(after[i])
-		}
-
-		// Skip the line after.
-		ln++
-		ln++
-
-		// Run the instruction against before for each possible op.
-		possible := make(map[int]bool)
-		for i, v := range ops {
-			result := v(rb, instr[1], instr[2], instr[3])
-			// See which match to the after.
-			if result == ra {
-				possible[i] = true
-				if *verbose {
-					fmt.Printf("matched instruction %s\n", opN[i])
-				}
-			}
+	for ln := 0; ln+4 < len(lines); ln += 4 {
+		// Each sample is before, instruction, after and a blank line.
+		var s asm.Sample
+		s.Before = parseRegisters(lines[ln])
+		s.Instruction = parseInstruction(lines[ln+1])
+		s.After = parseRegisters(lines[ln+2])
+		samples = append(samples, s)
+
+		matches := asm.Matches(s)
+		if *verbose {
+			fmt.Printf("%v matched %v\n", s.Instruction, matches)
 		}
 		// Increment the count of matching instructions if 3 or more all match.
-		if len(possible) >= 3 {
+		if len(matches) >= 3 {
 			multimatches++
 		}
-		if candidates[instr[0]] == nil {
-			candidates[instr[0]] = possible
-		} else {
-			for k := range candidates[instr[0]] {
-				if !possible[k] {
-					delete(candidates[instr[0]], k)
-				}
-			}
-			if len(candidates[instr[0]]) == 0 {
-				fmt.Println("Created impossibility.")
-			}
-		}
 	}
 
-	// Use process of elimination knowing that each opcode goes to exactly one op.
-	uniques := make(map[int]bool)
-	for len(uniques) != len(ops) {
-		for _, v := range candidates {
-			if len(v) == 1 {
-				for idx := range v {
-					uniques[idx] = true
-				}
-				continue
-			}
-			toClear := make([]int, 0)
-			for idx := range v {
-				if uniques[idx] {
-					// Someone else has taken us; clear.
-					toClear = append(toClear, idx)
-				}
-			}
-			for _, idx := range toClear {
-				delete(v, idx)
-			}
-		}
+	opcodes, err := asm.InferOpcodes(samples)
+	if err != nil {
+		fmt.Printf("Failed to infer opcodes: %v\n", err)
+		return
 	}
-
-	// Every opcode should have one index that matches.
-	opFunctions := make(map[int]asm.Op)
-	for k, v := range candidates {
-		for idx := range v {
-			opFunctions[k] = ops[idx]
-		}
+	program, err := asm.Decode(code, opcodes, registers)
+	if err != nil {
+		fmt.Printf("Failed to decode program: %v\n", err)
+		return
 	}
-
-	var r asm.Registers
-	for _, i := range instructions {
-		r = opFunctions[i[0]](r, i[1], i[2], i[3])
+	cpu, err := asm.NewCPUConfig(program, asm.Config{Registers: registers})
+	if err != nil {
+		fmt.Printf("Failed to load program: %v\n", err)
+		return
 	}
+	cpu.Run(0)
 
 	fmt.Printf("Multimatching instruction count: %d\n", multimatches)
-	fmt.Printf("Final value of register 0: %d\n", r[0])
+	fmt.Printf("Final value of register 0: %d\n", cpu.Regs[0])
+}
+
+func parseRegisters(l string) asm.Registers {
+	r := asm.NewRegisters(registers)
+	for i, v := range regDiagram.FindStringSubmatch(l)[1:5] {
+		r[i], _ = strconv.Atoi(v)
+	}
+	return r
+}
+
+func parseInstruction(l string) [4]int {
+	var instr [4]int
+	for i, v := range strings.Fields(l) {
+		if i < len(instr) {
+			instr[i], _ = strconv.Atoi(v)
+		}
+	}
+	return instr
 }
@@ -2,16 +2,14 @@ package main
 
 import (
 	"asm"
-	"bufio"
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 )
 
 var inputFile = flag.String("inputFile", "inputs/day19.input", "Relative file path to use as input.")
 var partB = flag.Bool("partB", false, "Whether to use the Part B logic.")
+var optimize = flag.Bool("optimize", true, "Whether to replace recognised loops with native code.")
 
 func main() {
 	flag.Parse()
@@ -21,41 +19,19 @@ func main() {
 	}
 	defer f.Close()
 
-	reader := bufio.NewReader(f)
-
-	instructions := make([]asm.Instruction, 0)
-	ipreg := -1
-
-	for idx := -1; ; idx++ {
-		l, err := reader.ReadString('\n')
-		if err != nil || len(l) == 0 {
-			break
-		}
-		l = l[:len(l)-1]
-
-		if idx == -1 {
-			// Read the instruction pointer register number.
-			ipreg, _ = strconv.Atoi(strings.Split(l, " ")[1])
-			continue
-		}
-
-		rawInstr := strings.Split(l, " ")
-		var instr asm.Instruction
-		instr.F = asm.AllOps[rawInstr[0]]
-		for i := 1; i < 4; i++ {
-			instr.Operands[i-1], _ = strconv.Atoi(rawInstr[i])
-		}
-		instructions = append(instructions, instr)
+	program, err := asm.Parse(f)
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
 	}
-
-	var r asm.Registers
-	if *partB {
-		r[0] = 1
+	cpu := asm.NewCPU(program)
+	if *optimize {
+		cpu.Macros = asm.Optimize(program)
 	}
-	for r[ipreg] >= 0 && r[ipreg] < len(instructions) {
-		instructions[r[ipreg]].Run(&r)
-		r[ipreg]++
+	if *partB {
+		cpu.Regs[0] = 1
 	}
+	cpu.Run(0)
 
-	fmt.Printf("Final value of register 0: %d\n", r[0])
+	fmt.Printf("Final value of register 0: %d\n", cpu.Regs[0])
 }
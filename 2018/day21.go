@@ -2,15 +2,13 @@ package main
 
 import (
 	"asm"
-	"bufio"
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 )
 
 var inputFile = flag.String("inputFile", "inputs/day21.input", "Relative file path to use as input.")
+var optimize = flag.Bool("optimize", true, "Whether to replace recognised loops with native code.")
 
 func main() {
 	flag.Parse()
@@ -20,67 +18,54 @@ func main() {
 	}
 	defer f.Close()
 
-	reader := bufio.NewReader(f)
-
-	instructions := make([]asm.Instruction, 0)
-	ipreg := -1
-
-	for idx := -1; ; idx++ {
-		l, err := reader.ReadString('\n')
-		if err != nil || len(l) == 0 {
-			break
-		}
-		l = l[:len(l)-1]
-
-		if idx == -1 {
-			// Read the instruction pointer register number.
-			ipreg, _ = strconv.Atoi(strings.Split(l, " ")[1])
+	program, err := asm.Parse(f)
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
+	}
+	// The only place our input in register 0 is read is an equality check
+	// against some other register; find it.
+	check, compared := -1, -1
+	for i, s := range program.Statements {
+		if s.Mnemonic != "eqrr" {
 			continue
 		}
-
-		rawInstr := strings.Split(l, " ")
-		var instr asm.Instruction
-		instr.F = asm.AllOps[rawInstr[0]]
-		for i := 1; i < 4; i++ {
-			instr.Operands[i-1], _ = strconv.Atoi(rawInstr[i])
+		if s.Operands[0] == 0 {
+			check, compared = i, s.Operands[1]
+		} else if s.Operands[1] == 0 {
+			check, compared = i, s.Operands[0]
 		}
-		instructions = append(instructions, instr)
+	}
+	if check == -1 {
+		fmt.Println("Could not find a comparison against register 0.")
+		return
 	}
 
-	var r asm.Registers
-	cycles := 0
+	cpu := asm.NewCPU(program)
+	if *optimize {
+		// Skips the slow divide-by-256 loop.
+		cpu.Macros = asm.Optimize(program)
+	}
+	cpu.Breakpoints = map[int]bool{check: true}
 	winners := make(map[int]int)
 	foundFirstWinner := false
 
-	for r[ipreg] >= 0 && r[ipreg] < len(instructions) {
-		cycles++
-		if r[ipreg] == 28 {
-			// This line tests for equality against our input.
-			// Find out what value would have matched, then pretend we didn't match.
-			if !foundFirstWinner {
-				foundFirstWinner = true
-				fmt.Printf("Smallest matching input is %d.\n", r[2])
-			}
-			if winners[r[2]] == 0 {
-				winners[r[2]] = cycles
-			} else {
-				// We've repeated and can stop.
-				break
-			}
-			r[ipreg] += 2
+	for cpu.Run(0) == asm.Breakpoint {
+		// Find out what value would have matched, then pretend we didn't match.
+		v := cpu.Regs[compared]
+		if !foundFirstWinner {
+			foundFirstWinner = true
+			fmt.Printf("Smallest matching input is %d.\n", v)
 		}
-		if r[ipreg] == 17 {
-			// Simulate doing the expensive divide operation to run faster.
-			r[5] /= 256
-			cycles += 9 + 7*r[5]
-			r[ipreg] = 8
+		if winners[v] != 0 {
+			// We've repeated and can stop.
+			break
 		}
-
-		instructions[r[ipreg]].Run(&r)
-		r[ipreg]++
+		winners[v] = cpu.Cycles + 1
+		cpu.IP += 2
 	}
 
-	fmt.Printf("Found a loop after %d cycles; stopping.\n", cycles)
+	fmt.Printf("Found a loop after %d cycles; stopping.\n", cpu.Cycles)
 
 	winningInput := -1
 	highest := 0
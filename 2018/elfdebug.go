@@ -0,0 +1,272 @@
+package main
+
+import (
+	"asm"
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var inputFile = flag.String("inputFile", "inputs/day19.input", "Relative file path of the ElfCode program to debug.")
+var initialRegs = flag.String("regs", "", "Comma-separated initial register values, e.g. 1,0,0,0,0,0.")
+var registers = flag.Int("registers", asm.DefaultRegisters, "The number of registers the machine has.")
+var word = flag.String("word", "unbounded", "Register semantics: unbounded, uint64 or maskN for N bits.")
+
+const help = `Commands:
+  s, step [n]        execute n instructions (default 1), printing each
+  c, continue        run until a breakpoint, watchpoint or halt
+  b, break <ip>      set a breakpoint before instruction ip
+  d, delete <ip>     remove the breakpoint at ip
+  w, watch <reg>     stop whenever register reg (not the ip register) changes
+  u, unwatch <reg>   stop watching register reg
+  p, print           print ip, cycle count and registers
+  set <reg> <value>  set a register; "set ip <n>" moves the instruction pointer
+  l, list [ip]       disassemble around ip (default the current one)
+  hits [n]           show the n most executed instructions (default all)
+  reset              restart the program with the initial registers
+  q, quit            exit
+An empty line repeats the previous command.`
+
+func main() {
+	flag.Parse()
+	f, err := os.Open(*inputFile)
+	if err != nil {
+		fmt.Printf("Failed to open input: %v\n", err)
+		return
+	}
+	program, err := asm.ParseWidth(f, *registers)
+	f.Close()
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
+	}
+	w, err := asm.ParseWord(*word)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	cfg := asm.Config{Registers: *registers, Word: w}
+
+	start := asm.NewRegisters(*registers)
+	if *initialRegs != "" {
+		for i, v := range strings.Split(*initialRegs, ",") {
+			if i >= len(start) {
+				fmt.Printf("Too many initial registers; there are only %d.\n", len(start))
+				return
+			}
+			start[i], err = strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				fmt.Printf("Failed to parse initial register %d: %v\n", i, err)
+				return
+			}
+		}
+	}
+
+	cpu, err := newCPU(program, cfg, start)
+	if err != nil {
+		fmt.Printf("Failed to load program: %v\n", err)
+		return
+	}
+	fmt.Printf("Loaded %d instructions, ip bound to register %d. Type \"help\" for commands.\n", len(program.Statements), program.IPReg)
+	printState(cpu)
+
+	in := bufio.NewScanner(os.Stdin)
+	last := ""
+	for {
+		fmt.Print("(elf) ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "h", "help":
+			fmt.Println(help)
+		case "q", "quit":
+			return
+		case "s", "step":
+			n := 1
+			if len(fields) > 1 {
+				if n, err = strconv.Atoi(fields[1]); err != nil {
+					fmt.Printf("Bad step count %q.\n", fields[1])
+					continue
+				}
+			}
+			for i := 0; i < n; i++ {
+				ip := cpu.IP
+				if !cpu.Step() {
+					fmt.Println("Program has halted.")
+					break
+				}
+				fmt.Printf("%4d  %-20s %v\n", ip, program.Statements[ip], cpu.Regs)
+			}
+		case "c", "continue":
+			reason := cpu.Run(0)
+			switch reason {
+			case asm.Watchpoint:
+				fmt.Printf("Watchpoint: register %d changed.\n", cpu.Watched)
+			default:
+				fmt.Printf("Stopped: %s.\n", reason)
+			}
+			printState(cpu)
+		case "b", "break", "d", "delete":
+			ip, ok := intArg(fields, len(program.Statements))
+			if !ok {
+				continue
+			}
+			if fields[0][0] == 'b' {
+				cpu.Breakpoints[ip] = true
+			} else {
+				delete(cpu.Breakpoints, ip)
+			}
+		case "w", "watch", "u", "unwatch":
+			reg, ok := intArg(fields, len(cpu.Regs))
+			if !ok {
+				continue
+			}
+			if fields[0][0] == 'w' {
+				if reg == cpu.IPReg {
+					fmt.Printf("Register %d is bound to ip and changes every step; use a breakpoint instead.\n", reg)
+					continue
+				}
+				cpu.Watchpoints[reg] = true
+			} else {
+				delete(cpu.Watchpoints, reg)
+			}
+		case "p", "print":
+			printState(cpu)
+		case "set":
+			if len(fields) != 3 {
+				fmt.Println("Usage: set <reg|ip> <value>")
+				continue
+			}
+			v, err := strconv.Atoi(fields[2])
+			if err != nil {
+				fmt.Printf("Bad value %q.\n", fields[2])
+				continue
+			}
+			if fields[1] == "ip" {
+				cpu.IP = v
+			} else if reg, ok := intArg(fields[:2], len(cpu.Regs)); ok {
+				cpu.Regs[reg] = v
+			}
+			printState(cpu)
+		case "l", "list":
+			center := cpu.IP
+			if len(fields) > 1 {
+				var ok bool
+				if center, ok = intArg(fields, len(program.Statements)); !ok {
+					continue
+				}
+			}
+			list(cpu, program, center-5, center+6)
+		case "hits":
+			n := len(program.Statements)
+			if len(fields) > 1 {
+				if n, err = strconv.Atoi(fields[1]); err != nil || n < 0 {
+					fmt.Printf("Bad count %q.\n", fields[1])
+					continue
+				}
+			}
+			hits(cpu, program, n)
+		case "reset":
+			bps, wps := cpu.Breakpoints, cpu.Watchpoints
+			cpu, _ = newCPU(program, cfg, start)
+			cpu.Breakpoints, cpu.Watchpoints = bps, wps
+			printState(cpu)
+		default:
+			fmt.Printf("Unknown command %q; type \"help\" for a list.\n", fields[0])
+		}
+	}
+}
+
+func newCPU(program asm.Program, cfg asm.Config, start asm.Registers) (*asm.CPU, error) {
+	cpu, err := asm.NewCPUConfig(program, cfg)
+	if err != nil {
+		return nil, err
+	}
+	copy(cpu.Regs, start)
+	cpu.Breakpoints = make(map[int]bool)
+	cpu.Watchpoints = make(map[int]bool)
+	return cpu, nil
+}
+
+// intArg parses fields[1] as an index in [0, limit).
+func intArg(fields []string, limit int) (int, bool) {
+	if len(fields) < 2 {
+		fmt.Printf("%s needs an argument.\n", fields[0])
+		return 0, false
+	}
+	v, err := strconv.Atoi(fields[1])
+	if err != nil || v < 0 || v >= limit {
+		fmt.Printf("Expected a number from 0 to %d, got %q.\n", limit-1, fields[1])
+		return 0, false
+	}
+	return v, true
+}
+
+func printState(cpu *asm.CPU) {
+	status := ""
+	if cpu.Halted() {
+		status = " (halted)"
+	}
+	fmt.Printf("ip=%d cycles=%d regs=%v%s\n", cpu.IP, cpu.Cycles, cpu.Regs, status)
+}
+
+func list(cpu *asm.CPU, program asm.Program, from, to int) {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(program.Statements) {
+		to = len(program.Statements)
+	}
+	for ip := from; ip < to; ip++ {
+		marker := "  "
+		if ip == cpu.IP {
+			marker = "=>"
+		}
+		bp := " "
+		if cpu.Breakpoints[ip] {
+			bp = "*"
+		}
+		s := program.Statements[ip]
+		comment := ""
+		if s.Comment != "" {
+			comment = " ; " + s.Comment
+		}
+		fmt.Printf("%s%s%4d  %-20s %10d hits%s\n", marker, bp, ip, s, cpu.Hits[ip], comment)
+	}
+}
+
+func hits(cpu *asm.CPU, program asm.Program, n int) {
+	order := make([]int, len(program.Statements))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return cpu.Hits[order[i]] > cpu.Hits[order[j]]
+	})
+	if n > len(order) {
+		n = len(order)
+	}
+	for _, ip := range order[:n] {
+		pct := 0.0
+		if cpu.Cycles > 0 {
+			pct = 100 * float64(cpu.Hits[ip]) / float64(cpu.Cycles)
+		}
+		fmt.Printf("%4d  %-20s %10d hits  %5.1f%%\n", ip, program.Statements[ip], cpu.Hits[ip], pct)
+	}
+}
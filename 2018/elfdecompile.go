@@ -0,0 +1,48 @@
+package main
+
+import (
+	"asm"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var inputFile = flag.String("inputFile", "inputs/day19.input", "Relative file path of the ElfCode program to decompile.")
+var goSource = flag.Bool("go", false, "Whether to emit a compilable Go function instead of pseudo-code.")
+var inputs = flag.String("inputs", "", "Comma-separated registers whose initial value may be something other than 0 or 1.")
+
+func main() {
+	flag.Parse()
+	f, err := os.Open(*inputFile)
+	if err != nil {
+		fmt.Printf("Failed to open input: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	program, err := asm.Parse(f)
+	if err != nil {
+		fmt.Printf("Failed to parse input: %v\n", err)
+		return
+	}
+
+	var regs []int
+	if *inputs != "" {
+		for _, v := range strings.Split(*inputs, ",") {
+			reg, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || reg < 0 || reg >= asm.DefaultRegisters {
+				fmt.Printf("Invalid input register %q.\n", v)
+				return
+			}
+			regs = append(regs, reg)
+		}
+	}
+
+	syntax := asm.Pseudo
+	if *goSource {
+		syntax = asm.GoSource
+	}
+	fmt.Print(asm.Decompile(program, syntax, regs...))
+}
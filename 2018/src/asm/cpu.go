@@ -0,0 +1,169 @@
+package asm
+
+// StopReason explains why CPU.Run returned.
+type StopReason int
+
+const (
+	StepLimit StopReason = iota
+	Halt
+	Breakpoint
+	Watchpoint
+)
+
+func (s StopReason) String() string {
+	switch s {
+	case StepLimit:
+		return "step limit"
+	case Halt:
+		return "halted"
+	case Breakpoint:
+		return "breakpoint"
+	case Watchpoint:
+		return "watchpoint"
+	}
+	return "unknown"
+}
+
+// TraceFunc gets the registers around each instruction; clone them to keep them.
+type TraceFunc func(ip int, in Instruction, before, after Registers)
+
+// CPU mirrors IP into IPReg around every instruction when IPReg >= 0.
+type CPU struct {
+	Program []Instruction
+	IPReg   int
+	IP      int
+	Regs    Registers
+	Word    Word
+	Cycles  int
+	// Hits is per instruction.
+	Hits []int
+
+	// Breakpoints stop Run before the instruction at that index executes.
+	Breakpoints map[int]bool
+	// Watchpoints stop Run once a register changes, noting it in Watched.
+	Watchpoints map[int]bool
+	Watched     int
+	Trace       TraceFunc
+
+	// Macros come from Optimize and only run untraced on Unbounded words.
+	Macros map[int]Macro
+
+	before, watched Registers
+	// resume is where execution left off, for Run's breakpoint check.
+	resume int
+}
+
+// DefaultRegisters is the size of the register file in the 2018 puzzles.
+const DefaultRegisters = 6
+
+// Config's zero value is the puzzles' machine.
+type Config struct {
+	Registers int
+	Word      Word
+}
+
+// NewCPU panics if p doesn't fit the default machine.
+func NewCPU(p Program) *CPU {
+	c, err := NewCPUConfig(p, Config{})
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewCPUConfig fails if p addresses registers cfg doesn't have.
+func NewCPUConfig(p Program, cfg Config) (*CPU, error) {
+	if cfg.Registers == 0 {
+		cfg.Registers = DefaultRegisters
+	}
+	if cfg.Word == nil {
+		cfg.Word = Unbounded
+	}
+	if err := p.Check(cfg.Registers); err != nil {
+		return nil, err
+	}
+	return &CPU{
+		Program: p.Instructions(),
+		IPReg:   p.IPReg,
+		Regs:    NewRegisters(cfg.Registers),
+		Word:    cfg.Word,
+		Hits:    make([]int, len(p.Statements)),
+		Watched: -1,
+		resume:  -1,
+	}, nil
+}
+
+// Halted means IP is outside the program.
+func (c *CPU) Halted() bool {
+	return c.IP < 0 || c.IP >= len(c.Program)
+}
+
+// Step is a no-op returning false once halted.
+func (c *CPU) Step() bool {
+	if c.Halted() {
+		return false
+	}
+	if m, ok := c.Macros[c.IP]; ok && c.Trace == nil && c.Word == Unbounded && !c.breakInside(m) && m.Apply(c) {
+		c.resume = c.IP
+		return true
+	}
+	ip := c.IP
+	if c.Trace != nil {
+		c.before = append(c.before[:0], c.Regs...)
+	}
+	if c.IPReg >= 0 {
+		c.Regs[c.IPReg] = c.IP
+	}
+	c.Program[c.IP].Run(c.Word, c.Regs)
+	if c.IPReg >= 0 {
+		c.IP = c.Regs[c.IPReg]
+	}
+	c.IP++
+	c.resume = c.IP
+	c.Cycles++
+	if ip < len(c.Hits) {
+		c.Hits[ip]++
+	}
+	if c.Trace != nil {
+		c.Trace(ip, c.Program[ip], c.before, c.Regs)
+	}
+	return true
+}
+
+func (c *CPU) breakInside(m Macro) bool {
+	for ip := m.Start + 1; ip < m.End; ip++ {
+		if c.Breakpoints[ip] {
+			return true
+		}
+	}
+	return false
+}
+
+// Run returns why it stopped, with maxSteps ignored unless positive. It
+// resumes past the breakpoint it stopped at, but not one IP was moved onto.
+func (c *CPU) Run(maxSteps int) StopReason {
+	c.Watched = -1
+	for steps := 0; maxSteps <= 0 || steps < maxSteps; steps++ {
+		if c.Breakpoints[c.IP] && (steps > 0 || c.IP != c.resume) {
+			c.resume = c.IP
+			return Breakpoint
+		}
+		if len(c.Watchpoints) > 0 {
+			c.watched = append(c.watched[:0], c.Regs...)
+		}
+		if !c.Step() {
+			return Halt
+		}
+		for reg := range c.Watchpoints {
+			// The bound register changes on every step; watch IP via breakpoints instead.
+			if reg != c.IPReg && reg < len(c.Regs) && c.watched[reg] != c.Regs[reg] {
+				c.Watched = reg
+				return Watchpoint
+			}
+		}
+	}
+	if c.Halted() {
+		return Halt
+	}
+	return StepLimit
+}
@@ -0,0 +1,27 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunBreakpointAfterMovingIP(t *testing.T) {
+	p, err := Parse(strings.NewReader("addi 0 1 0\naddi 0 1 0\naddi 0 1 0\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	c := NewCPU(p)
+	c.Breakpoints = map[int]bool{1: true}
+	if got := c.Run(0); got != Breakpoint || c.IP != 1 {
+		t.Fatalf("Run = %s at ip %d, want breakpoint at 1", got, c.IP)
+	}
+	c.IP = 0
+	c.Step()
+	if got := c.Run(0); got != Halt {
+		t.Errorf("Run after stepping onto breakpoint = %s, want halted", got)
+	}
+	c.IP = 1
+	if got := c.Run(0); got != Breakpoint || c.Cycles != 4 {
+		t.Errorf("Run after set ip = %s after %d cycles, want breakpoint after 4", got, c.Cycles)
+	}
+}
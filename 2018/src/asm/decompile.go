@@ -0,0 +1,1016 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Syntax selects the output language of Decompile.
+type Syntax int
+
+const (
+	// Pseudo is Go-flavoured pseudo-code using r0..r5 for registers.
+	Pseudo Syntax = iota
+	// GoSource is a compilable Go function run(r [N]int) [N]int, where N is
+	// the number of registers the program uses (at least DefaultRegisters).
+	GoSource
+)
+
+// Decompile recovers the control flow of an ip-bound program and prints it
+// as structured code with loops and if/else instead of jumps.
+//
+// Registers are assumed to start out as 0 or 1 unless listed in inputs; this
+// lets "addr 5 0 5" style jumps on a part A/B flag be read as branches. Jumps
+// whose target can't be worked out statically are printed as computed gotos,
+// and in that case (or whenever the flow graph can't be expressed with
+// loops and ifs alone) the output falls back to a labelled listing of the
+// basic blocks, which for GoSource is a switch over the program counter.
+func Decompile(p Program, syntax Syntax, inputs ...int) string {
+	d := &decompiler{
+		p:      p,
+		syntax: syntax,
+		n:      len(p.Statements),
+		width:  DefaultRegisters,
+	}
+	if p.IPReg >= d.width {
+		d.width = p.IPReg + 1
+	}
+	for _, s := range p.Statements {
+		for k, kind := range Signatures[s.Mnemonic] {
+			if kind == Register && s.Operands[k] >= d.width {
+				d.width = s.Operands[k] + 1
+			}
+		}
+	}
+	entry := uint(1)<<uint(d.width) - 1
+	for _, r := range inputs {
+		entry &^= 1 << uint(r)
+	}
+	d.analyze(entry)
+	d.buildBlocks()
+
+	e := &emitter{
+		d:          d,
+		done:       make([]bool, len(d.blocks)),
+		loopLabels: make(map[int]bool),
+		gotoLabels: make(map[int]bool),
+	}
+	e.findLoops()
+	var body []node
+	if len(d.blocks) > 0 {
+		body = e.seq(0, none, false)
+	}
+	body = trimContinue(body)
+
+	var out strings.Builder
+	if syntax == GoSource {
+		if e.gotos {
+			d.printDispatch(&out)
+		} else {
+			d.printGo(&out, e, body)
+		}
+		return out.String()
+	}
+	if p.IPReg >= 0 {
+		fmt.Fprintf(&out, "// ip is bound to r%d\n", p.IPReg)
+	}
+	if e.gotos {
+		d.printListing(&out)
+	} else {
+		e.print(&out, body, 0)
+	}
+	return out.String()
+}
+
+// Sentinel block indices used while structuring.
+const none = -2
+
+type flowKind int
+
+const (
+	flowNext     flowKind = iota // Fall through or jump unconditionally to next.
+	flowBranch                   // Go to alt if cond holds, otherwise next.
+	flowIndirect                 // Computed jump; target is expr.
+)
+
+type cond struct {
+	a, op, b string
+}
+
+func (c cond) not() cond {
+	switch c.op {
+	case "==":
+		c.op = "!="
+	case "!=":
+		c.op = "=="
+	case ">":
+		c.op = "<="
+	case "<=":
+		c.op = ">"
+	case "<":
+		c.op = ">="
+	case ">=":
+		c.op = "<"
+	}
+	return c
+}
+
+func (c cond) String() string {
+	return c.a + " " + c.op + " " + c.b
+}
+
+type flow struct {
+	kind      flowKind
+	next, alt int
+	cond      cond
+	condReg   int
+	expr      string
+}
+
+type block struct {
+	start, end int // Instructions [start, end); the last may be a jump.
+	succ       []int
+	pred       []int
+}
+
+type decompiler struct {
+	p      Program
+	syntax Syntax
+	n      int
+	width  int // Number of registers.
+
+	reached []bool
+	jump    []bool // Instruction writes the ip register.
+	flows   []flow
+	succ    [][]int // Instruction-level successors; n means the program halts.
+	preds   [][]int
+	fused   []bool // Comparison folded into the branch that follows it.
+
+	blocks  []block
+	blockAt []int // Instruction index to the block it starts, or -1.
+	exit    int   // Block index standing for "halted".
+}
+
+func (d *decompiler) reg(r int) string {
+	if d.syntax == GoSource {
+		return fmt.Sprintf("r[%d]", r)
+	}
+	return fmt.Sprintf("r%d", r)
+}
+
+// operand renders operand k of instruction i as an expression. Reads of the
+// ip register are constant: they always see the index of the instruction.
+func (d *decompiler) operand(i, k int) string {
+	s := d.p.Statements[i]
+	v := s.Operands[k]
+	if Signatures[s.Mnemonic][k] == Register {
+		if v == d.p.IPReg {
+			return fmt.Sprint(i)
+		}
+		return d.reg(v)
+	}
+	return fmt.Sprint(v)
+}
+
+var infix = map[string]string{
+	"add": "+", "mul": "*", "ban": "&", "bor": "|", "gt": ">", "eq": "==",
+}
+
+// rhs renders the value computed by instruction i.
+func (d *decompiler) rhs(i int) string {
+	s := d.p.Statements[i]
+	a, b := d.operand(i, 0), d.operand(i, 1)
+	switch s.Mnemonic[:2] {
+	case "se":
+		return a
+	case "gt", "eq":
+		return fmt.Sprintf("b2i(%s)", d.compare(i))
+	}
+	return fmt.Sprintf("%s %s %s", a, infix[s.Mnemonic[:3]], b)
+}
+
+func (d *decompiler) compare(i int) cond {
+	s := d.p.Statements[i]
+	c := cond{d.operand(i, 0), infix[s.Mnemonic[:2]], d.operand(i, 1)}
+	if Signatures[s.Mnemonic][0] == Immediate || d.p.IPReg == s.Operands[0] {
+		// Put the constant on the right: "256 > r5" reads better as "r5 < 256".
+		c.a, c.b = c.b, c.a
+		if c.op == ">" {
+			c.op = "<"
+		}
+	}
+	return c
+}
+
+func (d *decompiler) statement(i int) string {
+	s := d.p.Statements[i]
+	target := d.reg(s.Operands[2])
+	a, b := d.operand(i, 0), d.operand(i, 1)
+	if op, ok := infix[s.Mnemonic[:3]]; ok {
+		if a == target || (b == target && s.Mnemonic[3] == 'r') {
+			other := b
+			if b == target {
+				other = a
+			}
+			if op == "+" && other == "1" {
+				return target + "++"
+			}
+			return fmt.Sprintf("%s %s= %s", target, op, other)
+		}
+	}
+	return fmt.Sprintf("%s = %s", target, d.rhs(i))
+}
+
+func isComparison(mnemonic string) bool {
+	return strings.HasPrefix(mnemonic, "gt") || strings.HasPrefix(mnemonic, "eq")
+}
+
+// boolOperand reports whether operand k of instruction i is known to be 0 or
+// 1 given the set of registers known to hold booleans.
+func (d *decompiler) boolOperand(i, k int, bools uint) bool {
+	s := d.p.Statements[i]
+	v := s.Operands[k]
+	switch Signatures[s.Mnemonic][k] {
+	case Register:
+		if v == d.p.IPReg {
+			return i == 0 || i == 1
+		}
+		return bools&(1<<uint(v)) != 0
+	case Immediate:
+		return v == 0 || v == 1
+	}
+	return false
+}
+
+// transfer updates the set of registers known to hold booleans across
+// instruction i.
+func (d *decompiler) transfer(i int, bools uint) uint {
+	s := d.p.Statements[i]
+	c := s.Operands[2]
+	if c == d.p.IPReg {
+		return bools
+	}
+	isBool := false
+	switch {
+	case isComparison(s.Mnemonic):
+		isBool = true
+	case s.Mnemonic == "seti" || s.Mnemonic == "setr":
+		isBool = d.boolOperand(i, 0, bools)
+	case strings.HasPrefix(s.Mnemonic, "ban"):
+		isBool = d.boolOperand(i, 0, bools) || d.boolOperand(i, 1, bools)
+	case strings.HasPrefix(s.Mnemonic, "bor"), strings.HasPrefix(s.Mnemonic, "mul"):
+		isBool = d.boolOperand(i, 0, bools) && d.boolOperand(i, 1, bools)
+	}
+	if isBool {
+		return bools | 1<<uint(c)
+	}
+	return bools &^ (1 << uint(c))
+}
+
+// control works out where jump instruction i can go.
+func (d *decompiler) control(i int, bools uint) flow {
+	s := d.p.Statements[i]
+	sig := Signatures[s.Mnemonic]
+	ip := d.p.IPReg
+
+	constant := true
+	for k := 0; k < 2; k++ {
+		if sig[k] == Register && s.Operands[k] != ip {
+			constant = false
+		}
+	}
+	if constant {
+		r := NewRegisters(d.width)
+		r[ip] = i
+		s.Run(Unbounded, r)
+		return flow{kind: flowNext, next: d.clamp(r[ip] + 1)}
+	}
+
+	if s.Mnemonic == "addr" {
+		other := -1
+		if s.Operands[0] == ip {
+			other = s.Operands[1]
+		} else if s.Operands[1] == ip {
+			other = s.Operands[0]
+		}
+		if other >= 0 && bools&(1<<uint(other)) != 0 {
+			return flow{
+				kind:    flowBranch,
+				next:    d.clamp(i + 1),
+				alt:     d.clamp(i + 2),
+				cond:    cond{d.reg(other), "!=", "0"},
+				condReg: other,
+			}
+		}
+		if other >= 0 {
+			return flow{kind: flowIndirect, expr: fmt.Sprintf("%s + %d", d.reg(other), i+1)}
+		}
+	}
+	return flow{kind: flowIndirect, expr: fmt.Sprintf("(%s) + 1", d.rhs(i))}
+}
+
+func (d *decompiler) clamp(target int) int {
+	if target < 0 || target >= d.n {
+		return d.n
+	}
+	return target
+}
+
+func (d *decompiler) successors(i int, f flow) []int {
+	if !d.jump[i] {
+		return []int{d.clamp(i + 1)}
+	}
+	switch f.kind {
+	case flowBranch:
+		return []int{f.next, f.alt}
+	case flowIndirect:
+		all := make([]int, d.n+1)
+		for j := range all {
+			all[j] = j
+		}
+		return all
+	}
+	return []int{f.next}
+}
+
+func (d *decompiler) analyze(entry uint) {
+	d.reached = make([]bool, d.n)
+	d.jump = make([]bool, d.n)
+	d.flows = make([]flow, d.n)
+	d.succ = make([][]int, d.n)
+	d.preds = make([][]int, d.n+1)
+	d.fused = make([]bool, d.n)
+	if d.n == 0 {
+		return
+	}
+	for i, s := range d.p.Statements {
+		d.jump[i] = d.p.IPReg >= 0 && s.Operands[2] == d.p.IPReg
+	}
+
+	// Propagate which registers hold booleans until nothing changes. The
+	// sets only ever shrink, so this terminates.
+	bools := make([]uint, d.n)
+	d.reached[0] = true
+	bools[0] = entry
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if d.jump[i] {
+			d.flows[i] = d.control(i, bools[i])
+		}
+		out := d.transfer(i, bools[i])
+		for _, s := range d.successors(i, d.flows[i]) {
+			if s == d.n {
+				continue
+			}
+			if !d.reached[s] {
+				d.reached[s] = true
+				bools[s] = out
+				work = append(work, s)
+			} else if bools[s]&out != bools[s] {
+				bools[s] &= out
+				work = append(work, s)
+			}
+		}
+	}
+
+	for i := 0; i < d.n; i++ {
+		if !d.reached[i] {
+			continue
+		}
+		d.succ[i] = d.successors(i, d.flows[i])
+		for _, s := range d.succ[i] {
+			d.preds[s] = append(d.preds[s], i)
+		}
+	}
+
+	// Turn "eqrr 4 1 4; addr 4 5 5" into a branch on r4 == r1, dropping the
+	// comparison entirely when the flag register isn't read again.
+	live := d.liveness()
+	for i := 1; i < d.n; i++ {
+		f := &d.flows[i]
+		if !d.reached[i] || f.kind != flowBranch || len(d.preds[i]) != 1 || d.preds[i][0] != i-1 || d.jump[i-1] {
+			continue
+		}
+		prev := d.p.Statements[i-1]
+		if !isComparison(prev.Mnemonic) || prev.Operands[2] != f.condReg {
+			continue
+		}
+		if live[i]&(1<<uint(f.condReg)) == 0 {
+			d.fused[i-1] = true
+		} else if sig := Signatures[prev.Mnemonic]; (sig[0] == Register && prev.Operands[0] == f.condReg) ||
+			(sig[1] == Register && prev.Operands[1] == f.condReg) {
+			// The flag is still needed and has overwritten an input of the
+			// comparison, so test the flag itself.
+			continue
+		}
+		f.cond = d.compare(i - 1)
+	}
+}
+
+// liveness returns the registers that may be read after each instruction.
+func (d *decompiler) liveness() []uint {
+	all := uint(1)<<uint(d.width) - 1
+	uses := make([]uint, d.n)
+	defs := make([]uint, d.n)
+	for i, s := range d.p.Statements {
+		sig := Signatures[s.Mnemonic]
+		for k := 0; k < 2; k++ {
+			if sig[k] == Register && s.Operands[k] != d.p.IPReg {
+				uses[i] |= 1 << uint(s.Operands[k])
+			}
+		}
+		if !d.jump[i] {
+			defs[i] = 1 << uint(s.Operands[2])
+		}
+	}
+	liveOut := make([]uint, d.n)
+	for changed := true; changed; {
+		changed = false
+		for i := d.n - 1; i >= 0; i-- {
+			out := uint(0)
+			for _, s := range d.succ[i] {
+				if s == d.n {
+					// Everything is observable once the program halts.
+					out = all
+				} else {
+					out |= uses[s] | (liveOut[s] &^ defs[s])
+				}
+			}
+			if out != liveOut[i] {
+				liveOut[i] = out
+				changed = true
+			}
+		}
+	}
+	return liveOut
+}
+
+func (d *decompiler) buildBlocks() {
+	d.blockAt = make([]int, d.n+1)
+	for i := range d.blockAt {
+		d.blockAt[i] = -1
+	}
+	for i := 0; i < d.n; i++ {
+		if !d.reached[i] {
+			continue
+		}
+		leader := i == 0 || len(d.preds[i]) != 1 || d.preds[i][0] != i-1 || d.jump[i-1]
+		if leader {
+			d.blockAt[i] = len(d.blocks)
+			d.blocks = append(d.blocks, block{start: i})
+		}
+	}
+	d.exit = len(d.blocks)
+	d.blockAt[d.n] = d.exit
+	for b := range d.blocks {
+		blk := &d.blocks[b]
+		end := blk.start + 1
+		for end < d.n && !d.jump[end-1] && d.blockAt[end] == -1 && d.reached[end] {
+			end++
+		}
+		blk.end = end
+		for _, s := range d.succ[end-1] {
+			t := d.blockAt[s]
+			blk.succ = append(blk.succ, t)
+		}
+	}
+	for b, blk := range d.blocks {
+		for _, s := range blk.succ {
+			if s != d.exit {
+				d.blocks[s].pred = append(d.blocks[s].pred, b)
+			}
+		}
+	}
+}
+
+// idoms computes immediate dominators with the Cooper-Harvey-Kennedy
+// algorithm. Nodes unreachable from entry get -1.
+func idoms(n, entry int, succ, pred func(int) []int) []int {
+	order := make([]int, n) // Reverse postorder number.
+	for i := range order {
+		order[i] = -1
+	}
+	var post []int
+	seen := make([]bool, n)
+	var visit func(int)
+	visit = func(v int) {
+		seen[v] = true
+		for _, s := range succ(v) {
+			if !seen[s] {
+				visit(s)
+			}
+		}
+		post = append(post, v)
+	}
+	visit(entry)
+	rpo := make([]int, len(post))
+	for i, v := range post {
+		rpo[len(post)-1-i] = v
+		order[v] = len(post) - 1 - i
+	}
+
+	idom := make([]int, n)
+	for i := range idom {
+		idom[i] = -1
+	}
+	idom[entry] = entry
+	intersect := func(a, b int) int {
+		for a != b {
+			for order[a] > order[b] {
+				a = idom[a]
+			}
+			for order[b] > order[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, v := range rpo[1:] {
+			next := -1
+			for _, p := range pred(v) {
+				if idom[p] == -1 {
+					continue
+				}
+				if next == -1 {
+					next = p
+				} else {
+					next = intersect(p, next)
+				}
+			}
+			if idom[v] != next {
+				idom[v] = next
+				changed = true
+			}
+		}
+	}
+	return idom
+}
+
+type loop struct {
+	header int
+	follow int
+	nodes  map[int]bool
+	broken bool // Something breaks out of the loop.
+}
+
+type emitter struct {
+	d       *decompiler
+	dom     []int
+	postdom []int
+	loops   map[int]*loop
+
+	done       []bool
+	stack      []*loop
+	gotos      bool
+	loopLabels map[int]bool
+	gotoLabels map[int]bool
+}
+
+func (e *emitter) dominates(a, b int) bool {
+	for b != -1 {
+		if a == b {
+			return true
+		}
+		if e.dom[b] == b {
+			return false
+		}
+		b = e.dom[b]
+	}
+	return false
+}
+
+func (e *emitter) findLoops() {
+	d := e.d
+	e.loops = make(map[int]*loop)
+	if len(d.blocks) == 0 {
+		return
+	}
+	succ := func(b int) []int {
+		if b == d.exit {
+			return nil
+		}
+		return d.blocks[b].succ
+	}
+	pred := func(b int) []int {
+		if b == d.exit {
+			return nil
+		}
+		return d.blocks[b].pred
+	}
+	e.dom = idoms(len(d.blocks)+1, 0, succ, pred)
+
+	// Post-dominators are dominators of the reversed graph rooted at exit.
+	var exitPreds []int
+	for b, blk := range d.blocks {
+		for _, s := range blk.succ {
+			if s == d.exit {
+				exitPreds = append(exitPreds, b)
+			}
+		}
+	}
+	e.postdom = idoms(len(d.blocks)+1, d.exit, func(b int) []int {
+		if b == d.exit {
+			return exitPreds
+		}
+		return d.blocks[b].pred
+	}, succ)
+
+	for u, blk := range d.blocks {
+		for _, h := range blk.succ {
+			if h == d.exit || !e.dominates(h, u) {
+				continue
+			}
+			l := e.loops[h]
+			if l == nil {
+				l = &loop{header: h, follow: none, nodes: map[int]bool{h: true}}
+				e.loops[h] = l
+			}
+			work := []int{u}
+			for len(work) > 0 {
+				v := work[len(work)-1]
+				work = work[:len(work)-1]
+				if l.nodes[v] {
+					continue
+				}
+				l.nodes[v] = true
+				work = append(work, d.blocks[v].pred...)
+			}
+		}
+	}
+	for _, l := range e.loops {
+		for v := range l.nodes {
+			for _, s := range d.blocks[v].succ {
+				if l.nodes[s] || s == d.exit {
+					continue
+				}
+				if l.follow == none || s < l.follow {
+					l.follow = s
+				}
+			}
+		}
+	}
+}
+
+type node interface{}
+
+type stmtNode string
+
+type labelNode int
+
+type ifNode struct {
+	cond      cond
+	then, els []node
+}
+
+type loopNode struct {
+	header int
+	body   []node
+	broken bool
+}
+
+type jumpKind int
+
+const (
+	jumpBreak jumpKind = iota
+	jumpContinue
+	jumpHalt
+	jumpGoto
+	jumpIndirect
+)
+
+type jumpNode struct {
+	kind     jumpKind
+	target   int // Loop header or instruction index.
+	labelled bool
+	expr     string
+}
+
+// transfer returns the node that moves control to block b without emitting
+// it, or nil if b should be emitted inline next.
+func (e *emitter) transfer(b int) node {
+	if b == e.d.exit {
+		return &jumpNode{kind: jumpHalt}
+	}
+	for i := len(e.stack) - 1; i >= 0; i-- {
+		l := e.stack[i]
+		labelled := i != len(e.stack)-1
+		if b == l.header || b == l.follow {
+			if labelled {
+				e.loopLabels[l.header] = true
+			}
+			kind := jumpContinue
+			if b == l.follow {
+				kind = jumpBreak
+				l.broken = true
+			}
+			return &jumpNode{kind: kind, target: l.header, labelled: labelled}
+		}
+	}
+	if e.done[b] {
+		e.gotos = true
+		e.gotoLabels[e.d.blocks[b].start] = true
+		return &jumpNode{kind: jumpGoto, target: e.d.blocks[b].start}
+	}
+	return nil
+}
+
+func (e *emitter) inLoop(b int) bool {
+	if len(e.stack) == 0 {
+		return true
+	}
+	return e.stack[len(e.stack)-1].nodes[b]
+}
+
+// seq emits blocks starting at b until control reaches follow. If entering
+// is set, b is the header of the loop being entered and is emitted directly.
+func (e *emitter) seq(b, follow int, entering bool) []node {
+	d := e.d
+	var out []node
+	for b != follow {
+		if !entering {
+			if n := e.transfer(b); n != nil {
+				return append(out, n)
+			}
+			if l := e.loops[b]; l != nil {
+				e.stack = append(e.stack, l)
+				body := trimContinue(e.seq(b, none, true))
+				e.stack = e.stack[:len(e.stack)-1]
+				out = append(out, &loopNode{header: b, body: body, broken: l.broken})
+				if l.follow == none {
+					return out
+				}
+				b = l.follow
+				continue
+			}
+		}
+		entering = false
+
+		e.done[b] = true
+		blk := d.blocks[b]
+		out = append(out, labelNode(blk.start))
+		last := blk.end - 1
+		for i := blk.start; i < blk.end; i++ {
+			if !d.fused[i] && !d.jump[i] {
+				out = append(out, stmtNode(d.statement(i)))
+			}
+		}
+		if !d.jump[last] {
+			b = blk.succ[0]
+			continue
+		}
+		f := d.flows[last]
+		switch f.kind {
+		case flowNext:
+			b = blk.succ[0]
+		case flowIndirect:
+			e.gotos = true
+			return append(out, &jumpNode{kind: jumpIndirect, expr: f.expr})
+		case flowBranch:
+			t, f2 := d.blockAt[f.alt], d.blockAt[f.next]
+			merge := e.postdom[b]
+			if merge == -1 || merge == d.exit || !e.inLoop(merge) {
+				merge = none
+			}
+			then := e.seq(t, merge, false)
+			els := e.seq(f2, merge, false)
+			out = append(out, &ifNode{cond: f.cond, then: then, els: els})
+			if merge == none {
+				return out
+			}
+			b = merge
+		}
+	}
+	return out
+}
+
+// trimContinue drops continue statements that are the last thing executed
+// in a loop body anyway.
+func trimContinue(nodes []node) []node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+	switch n := nodes[len(nodes)-1].(type) {
+	case *jumpNode:
+		if n.kind == jumpContinue && !n.labelled {
+			return nodes[:len(nodes)-1]
+		}
+	case *ifNode:
+		n.then = trimContinue(n.then)
+		n.els = trimContinue(n.els)
+	}
+	return nodes
+}
+
+// fallsThrough reports whether control can run off the end of nodes.
+func fallsThrough(nodes []node) bool {
+	if len(nodes) == 0 {
+		return true
+	}
+	switch n := nodes[len(nodes)-1].(type) {
+	case *jumpNode:
+		return false
+	case *loopNode:
+		return n.broken
+	case *ifNode:
+		return fallsThrough(n.then) || fallsThrough(n.els)
+	}
+	return true
+}
+
+// leaves reports whether nodes always ends by transferring control elsewhere.
+func leaves(nodes []node) bool {
+	if len(nodes) == 0 {
+		return false
+	}
+	_, ok := nodes[len(nodes)-1].(*jumpNode)
+	return ok
+}
+
+// empty reports whether nodes contains nothing but labels nobody jumps to.
+func (e *emitter) empty(nodes []node) bool {
+	for _, n := range nodes {
+		if l, ok := n.(labelNode); ok && !e.gotoLabels[int(l)] {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func (e *emitter) print(out *strings.Builder, nodes []node, depth int) {
+	d := e.d
+	indent := strings.Repeat("\t", depth)
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case stmtNode:
+			fmt.Fprintf(out, "%s%s\n", indent, n)
+		case labelNode:
+			if e.gotoLabels[int(n)] {
+				fmt.Fprintf(out, "L%d:\n", n)
+			}
+		case *ifNode:
+			c, then, els := n.cond, n.then, n.els
+			if e.empty(then) {
+				c, then, els = c.not(), els, then
+			}
+			if e.empty(then) {
+				continue
+			}
+			fmt.Fprintf(out, "%sif %s {\n", indent, c)
+			e.print(out, then, depth+1)
+			if e.empty(els) {
+				fmt.Fprintf(out, "%s}\n", indent)
+			} else if leaves(then) {
+				// No need for an else when the then branch never falls out.
+				fmt.Fprintf(out, "%s}\n", indent)
+				e.print(out, els, depth)
+			} else {
+				fmt.Fprintf(out, "%s} else {\n", indent)
+				e.print(out, els, depth+1)
+				fmt.Fprintf(out, "%s}\n", indent)
+			}
+		case *loopNode:
+			if e.loopLabels[n.header] {
+				fmt.Fprintf(out, "%sloop%d:\n", indent, d.blocks[n.header].start)
+			}
+			fmt.Fprintf(out, "%sfor {\n", indent)
+			e.print(out, n.body, depth+1)
+			fmt.Fprintf(out, "%s}\n", indent)
+		case *jumpNode:
+			switch n.kind {
+			case jumpBreak, jumpContinue:
+				word := "break"
+				if n.kind == jumpContinue {
+					word = "continue"
+				}
+				if n.labelled {
+					fmt.Fprintf(out, "%s%s loop%d\n", indent, word, d.blocks[n.target].start)
+				} else {
+					fmt.Fprintf(out, "%s%s\n", indent, word)
+				}
+			case jumpHalt:
+				if d.syntax == GoSource {
+					fmt.Fprintf(out, "%sreturn r\n", indent)
+				} else {
+					fmt.Fprintf(out, "%shalt\n", indent)
+				}
+			case jumpGoto:
+				fmt.Fprintf(out, "%sgoto L%d\n", indent, n.target)
+			case jumpIndirect:
+				fmt.Fprintf(out, "%sgoto L(%s)\n", indent, n.expr)
+			}
+		}
+	}
+}
+
+func (d *decompiler) printHeader(out *strings.Builder) {
+	fmt.Fprintf(out, "// run is decompiled from a %d instruction ElfCode program", d.n)
+	if d.p.IPReg >= 0 {
+		fmt.Fprintf(out, "\n// with the instruction pointer bound to r[%d]", d.p.IPReg)
+	}
+	fmt.Fprintf(out, ".\nfunc run(r [%d]int) [%d]int {\n", d.width, d.width)
+}
+
+const b2iSource = `
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+`
+
+func (d *decompiler) printGo(out *strings.Builder, e *emitter, body []node) {
+	d.printHeader(out)
+	e.print(out, body, 1)
+	if fallsThrough(body) {
+		out.WriteString("\treturn r\n")
+	}
+	out.WriteString("}\n")
+	out.WriteString(b2iSource)
+}
+
+// printListing emits the program's basic blocks in order as labelled
+// pseudo-code joined by gotos, which can express any control flow.
+func (d *decompiler) printListing(out *strings.Builder) {
+	target := func(t int) string {
+		if t == d.n {
+			return "halt"
+		}
+		return fmt.Sprintf("goto L%d", t)
+	}
+	for b, blk := range d.blocks {
+		fmt.Fprintf(out, "L%d:\n", blk.start)
+		for i := blk.start; i < blk.end; i++ {
+			if !d.fused[i] && !d.jump[i] {
+				fmt.Fprintf(out, "\t%s\n", d.statement(i))
+			}
+		}
+		// Falling into the next block needs no goto.
+		next := d.n
+		if b+1 < len(d.blocks) {
+			next = d.blocks[b+1].start
+		}
+		jump := func(t int) {
+			if t != next || t == d.n {
+				fmt.Fprintf(out, "\t%s\n", target(t))
+			}
+		}
+		last := blk.end - 1
+		if !d.jump[last] {
+			jump(d.clamp(last + 1))
+			continue
+		}
+		f := d.flows[last]
+		switch f.kind {
+		case flowNext:
+			jump(f.next)
+		case flowBranch:
+			fmt.Fprintf(out, "\tif %s {\n\t\t%s\n\t}\n", f.cond, target(f.alt))
+			jump(f.next)
+		case flowIndirect:
+			fmt.Fprintf(out, "\tgoto L(%s)\n", f.expr)
+		}
+	}
+}
+
+// printDispatch emits the program as a switch over the program counter, which
+// can express any control flow.
+func (d *decompiler) printDispatch(out *strings.Builder) {
+	d.printHeader(out)
+	out.WriteString("\tpc := 0\n\tfor {\n\t\tswitch pc {\n")
+	target := func(t int) string {
+		if t == d.n {
+			return "return r"
+		}
+		return fmt.Sprintf("pc = %d", t)
+	}
+	for _, blk := range d.blocks {
+		fmt.Fprintf(out, "\t\tcase %d:\n", blk.start)
+		for i := blk.start; i < blk.end; i++ {
+			if !d.fused[i] && !d.jump[i] {
+				fmt.Fprintf(out, "\t\t\t%s\n", d.statement(i))
+			}
+		}
+		last := blk.end - 1
+		if !d.jump[last] {
+			fmt.Fprintf(out, "\t\t\t%s\n", target(d.clamp(last+1)))
+			continue
+		}
+		f := d.flows[last]
+		switch f.kind {
+		case flowNext:
+			fmt.Fprintf(out, "\t\t\t%s\n", target(f.next))
+		case flowBranch:
+			fmt.Fprintf(out, "\t\t\tif %s {\n\t\t\t\t%s\n\t\t\t} else {\n\t\t\t\t%s\n\t\t\t}\n", f.cond, target(f.alt), target(f.next))
+		case flowIndirect:
+			fmt.Fprintf(out, "\t\t\tpc = %s\n", f.expr)
+		}
+	}
+	out.WriteString("\t\tdefault:\n\t\t\treturn r\n\t\t}\n\t}\n}\n")
+	out.WriteString(b2iSource)
+}
@@ -0,0 +1,41 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+)
+
+func decompile(t *testing.T, src string, syntax Syntax, inputs ...int) string {
+	p, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return Decompile(p, syntax, inputs...)
+}
+
+func TestDecompileComputedJump(t *testing.T) {
+	src := "#ip 0\naddr 0 1 0\nseti 100 0 0\naddi 1 1 1\n"
+	out := decompile(t, src, Pseudo, 1)
+	for _, want := range []string{"L0:\n", "goto L(r1 + 1)", "L2:\n\tr1++\n\thalt\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("pseudo output missing %q:\n%s", want, out)
+		}
+	}
+	out = decompile(t, src, GoSource, 1)
+	for _, want := range []string{"pc = r[1] + 1", "r[1]++"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Go output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDecompileReturnAfterIf(t *testing.T) {
+	src := "#ip 0\ngtri 1 5 2\naddr 2 0 0\nseti 99 0 0\naddi 3 1 3\nseti 99 0 0\n"
+	out := decompile(t, src, GoSource)
+	if strings.Contains(out, "return r\n\treturn r") {
+		t.Errorf("unreachable return emitted:\n%s", out)
+	}
+	if n := strings.Count(out, "return r\n"); n != 2 {
+		t.Errorf("got %d returns, want 2:\n%s", n, out)
+	}
+}
@@ -0,0 +1,148 @@
+package asm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sample is an observation of one numbered instruction, "opcode A B C", and
+// the registers before and after it ran.
+type Sample struct {
+	Before, After Registers
+	Instruction   [4]int
+}
+
+// Matches returns the names of every op that behaves as the sample did.
+func Matches(s Sample) []string {
+	ret := make([]string, 0)
+	for name, op := range AllOps {
+		if !fits(name, s.Instruction[1:], len(s.Before)) {
+			continue
+		}
+		r := s.Before.Clone()
+		op(Unbounded, r, s.Instruction[1], s.Instruction[2], s.Instruction[3])
+		if r.Equal(s.After) {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// fits reports whether the operands are valid registers where op needs them.
+func fits(name string, operands []int, registers int) bool {
+	for i, kind := range Signatures[name] {
+		if kind == Register && (operands[i] < 0 || operands[i] >= registers) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContradictionError means no op is consistent with every sample of Opcode,
+// or that the only ops left for it have been claimed by other opcodes.
+type ContradictionError struct {
+	Opcode int
+}
+
+func (e *ContradictionError) Error() string {
+	return fmt.Sprintf("no op is consistent with every sample of opcode %d", e.Opcode)
+}
+
+// AmbiguityError means the samples don't pin down which op some opcodes are.
+type AmbiguityError struct {
+	Candidates map[int][]string
+}
+
+func (e *AmbiguityError) Error() string {
+	opcodes := make([]int, 0, len(e.Candidates))
+	for k := range e.Candidates {
+		opcodes = append(opcodes, k)
+	}
+	sort.Ints(opcodes)
+	parts := make([]string, len(opcodes))
+	for i, k := range opcodes {
+		parts[i] = fmt.Sprintf("%d: %s", k, strings.Join(e.Candidates[k], "/"))
+	}
+	return "ambiguous opcodes: " + strings.Join(parts, ", ")
+}
+
+// InferOpcodes works out which op each opcode in the samples stands for,
+// knowing that every opcode is a different op.
+func InferOpcodes(samples []Sample) (map[int]string, error) {
+	candidates := make(map[int]map[string]bool)
+	for _, s := range samples {
+		possible := make(map[string]bool)
+		for _, name := range Matches(s) {
+			possible[name] = true
+		}
+		opcode := s.Instruction[0]
+		if candidates[opcode] == nil {
+			candidates[opcode] = possible
+			continue
+		}
+		for name := range candidates[opcode] {
+			if !possible[name] {
+				delete(candidates[opcode], name)
+			}
+		}
+	}
+
+	// Use process of elimination: an opcode with one candidate left claims
+	// it, which removes it from every other opcode.
+	result := make(map[int]string)
+	for progress := true; progress; {
+		progress = false
+		for opcode, names := range candidates {
+			if len(names) == 0 {
+				return nil, &ContradictionError{opcode}
+			}
+			if len(names) != 1 {
+				continue
+			}
+			for name := range names {
+				result[opcode] = name
+				for other, otherNames := range candidates {
+					if other != opcode {
+						delete(otherNames, name)
+					}
+				}
+			}
+			delete(candidates, opcode)
+			progress = true
+		}
+	}
+
+	if len(candidates) > 0 {
+		err := &AmbiguityError{make(map[int][]string)}
+		for opcode, names := range candidates {
+			for name := range names {
+				err.Candidates[opcode] = append(err.Candidates[opcode], name)
+			}
+			sort.Strings(err.Candidates[opcode])
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// Decode turns a program of "opcode A B C" lines into a named one using the
+// mapping from InferOpcodes, for a machine with the given number of
+// registers.
+func Decode(code [][4]int, opcodes map[int]string, registers int) (Program, error) {
+	p := Program{IPReg: -1}
+	for i, c := range code {
+		name, ok := opcodes[c[0]]
+		if !ok {
+			return p, &ParseError{i + 1, fmt.Sprintf("unknown opcode %d", c[0])}
+		}
+		s, err := newStatement(name, [3]int{c[1], c[2], c[3]}, registers)
+		if err != nil {
+			return p, &ParseError{i + 1, err.Error()}
+		}
+		s.Line = i + 1
+		p.Statements = append(p.Statements, s)
+	}
+	return p, nil
+}
@@ -1,120 +1,112 @@
 package asm
 
-type Registers [6]int
+// Registers is the register file of a CPU. Its length is the number of
+// registers the program can address.
+type Registers []int
+
+func NewRegisters(n int) Registers {
+	return make(Registers, n)
+}
+
+func (r Registers) Clone() Registers {
+	return append(Registers(nil), r...)
+}
+
+func (r Registers) Equal(o Registers) bool {
+	if len(r) != len(o) {
+		return false
+	}
+	for i := range r {
+		if r[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
 type Instruction struct {
 	F        Op
 	Operands [3]int
 }
 
-func (i Instruction) Run(r *Registers) {
-	*r = i.F(*r, i.Operands[0], i.Operands[1], i.Operands[2])
+func (i Instruction) Run(w Word, r Registers) {
+	i.F(w, r, i.Operands[0], i.Operands[1], i.Operands[2])
 }
 
-type Op func(Registers, int, int, int) Registers
+// Op executes an instruction in place, storing its result in register c.
+type Op func(w Word, r Registers, a, b, c int)
 
-func Addr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] + r[operB]
-	return result
-}
-func Addi(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] + operB
-	return result
-}
-func Mulr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] * r[operB]
-	return result
-}
-func Muli(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] * operB
-	return result
-}
-func Banr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] & r[operB]
-	return result
-}
-func Bani(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] & operB
-	return result
-}
-func Borr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] | r[operB]
-	return result
-}
-func Bori(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA] | operB
-	return result
-}
-func Setr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = r[operA]
-	return result
-}
-func Seti(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	result[targetReg] = operA
-	return result
-}
-func Gtir(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	if operA > r[operB] {
-		result[targetReg] = 1
+func Addr(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] + r[b])
+}
+func Addi(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] + b)
+}
+func Mulr(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] * r[b])
+}
+func Muli(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] * b)
+}
+func Banr(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] & r[b])
+}
+func Bani(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] & b)
+}
+func Borr(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] | r[b])
+}
+func Bori(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a] | b)
+}
+func Setr(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(r[a])
+}
+func Seti(w Word, r Registers, a, b, c int) {
+	r[c] = w.Wrap(a)
+}
+func Gtir(w Word, r Registers, a, b, c int) {
+	if w.Greater(a, r[b]) {
+		r[c] = 1
 	} else {
-		result[targetReg] = 0
+		r[c] = 0
 	}
-	return result
 }
-func Gtri(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	if r[operA] > operB {
-		result[targetReg] = 1
+func Gtri(w Word, r Registers, a, b, c int) {
+	if w.Greater(r[a], b) {
+		r[c] = 1
 	} else {
-		result[targetReg] = 0
+		r[c] = 0
 	}
-	return result
 }
-func Gtrr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	if r[operA] > r[operB] {
-		result[targetReg] = 1
+func Gtrr(w Word, r Registers, a, b, c int) {
+	if w.Greater(r[a], r[b]) {
+		r[c] = 1
 	} else {
-		result[targetReg] = 0
+		r[c] = 0
 	}
-	return result
 }
-func Eqir(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	if operA == r[operB] {
-		result[targetReg] = 1
+func Eqir(w Word, r Registers, a, b, c int) {
+	if a == r[b] {
+		r[c] = 1
 	} else {
-		result[targetReg] = 0
+		r[c] = 0
 	}
-	return result
 }
-func Eqri(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	if r[operA] == operB {
-		result[targetReg] = 1
+func Eqri(w Word, r Registers, a, b, c int) {
+	if r[a] == b {
+		r[c] = 1
 	} else {
-		result[targetReg] = 0
+		r[c] = 0
 	}
-	return result
 }
-func Eqrr(r Registers, operA, operB, targetReg int) Registers {
-	result := r
-	if r[operA] == r[operB] {
-		result[targetReg] = 1
+func Eqrr(w Word, r Registers, a, b, c int) {
+	if r[a] == r[b] {
+		r[c] = 1
 	} else {
-		result[targetReg] = 0
+		r[c] = 0
 	}
-	return result
 }
 
 var AllOps = map[string]Op{
@@ -135,3 +127,32 @@ var AllOps = map[string]Op{
 	"eqri": Eqri,
 	"eqrr": Eqrr,
 }
+
+// Operand describes how an instruction interprets one of its three operands.
+type Operand int
+
+const (
+	Ignored Operand = iota
+	Immediate
+	Register
+)
+
+// Signatures records, for each op, how its A, B and C operands are used.
+var Signatures = map[string][3]Operand{
+	"addr": {Register, Register, Register},
+	"addi": {Register, Immediate, Register},
+	"mulr": {Register, Register, Register},
+	"muli": {Register, Immediate, Register},
+	"banr": {Register, Register, Register},
+	"bani": {Register, Immediate, Register},
+	"borr": {Register, Register, Register},
+	"bori": {Register, Immediate, Register},
+	"setr": {Register, Ignored, Register},
+	"seti": {Immediate, Ignored, Register},
+	"gtir": {Immediate, Register, Register},
+	"gtri": {Register, Immediate, Register},
+	"gtrr": {Register, Register, Register},
+	"eqir": {Immediate, Register, Register},
+	"eqri": {Register, Immediate, Register},
+	"eqrr": {Register, Register, Register},
+}
@@ -0,0 +1,209 @@
+package asm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Macro stands in for the instructions [Start, End) with a native
+// implementation. Apply returns false if the macro can't handle the current
+// register state, in which case the CPU executes the instructions as usual.
+type Macro struct {
+	Name       string
+	Start, End int
+	Apply      func(c *CPU) bool
+}
+
+// bindings maps pattern variables to the registers or immediates they matched.
+type bindings map[string]int
+
+// idiom is a well-known instruction sequence. In the pattern, lowercase names
+// are distinct registers other than the ip register, "ip" is the ip register,
+// "#name" captures an immediate, "@k" is the literal start+k, "_" matches
+// anything and numbers match themselves. Operands of commutative ops may
+// appear in either order.
+type idiom struct {
+	name    string
+	pattern []string
+	macro   func(start int, b bindings) func(c *CPU) bool
+}
+
+var idioms = []idiom{
+	{
+		// r[acc] += the sum of the divisors of r[n], by trying every pair of
+		// numbers up to n and checking whether their product is n.
+		name: "divisor sum",
+		pattern: []string{
+			"seti 1 _ i",
+			"seti 1 _ j",
+			"mulr i j t",
+			"eqrr t n t",
+			"addr t ip ip",
+			"addi ip 1 ip",
+			"addr i acc acc",
+			"addi j 1 j",
+			"gtrr j n t",
+			"addr ip t ip",
+			"seti @1 _ ip",
+			"addi i 1 i",
+			"gtrr i n t",
+			"addr t ip ip",
+			"seti @0 _ ip",
+		},
+		macro: func(start int, b bindings) func(c *CPU) bool {
+			return func(c *CPU) bool {
+				n := c.Regs[b["n"]]
+				if n < 1 {
+					return false
+				}
+				sum := 0
+				for x := 1; x*x <= n; x++ {
+					if n%x == 0 {
+						sum += x
+						if x*x != n {
+							sum += n / x
+						}
+					}
+				}
+				c.Regs[b["acc"]] += sum
+				c.Regs[b["i"]] = n + 1
+				c.Regs[b["j"]] = n + 1
+				c.Regs[b["t"]] = 1
+				c.Regs[b["ip"]] = start + 14
+				c.IP = start + 15
+				// Each inner iteration is 8 instructions (7 for the last),
+				// wrapped in 4 per outer iteration (3 for the last).
+				c.Cycles += 8*n*n + 4*n
+				return true
+			}
+		},
+	},
+	{
+		// r[x] /= d, by counting up q until (q+1)*d > r[x].
+		name: "divide by constant",
+		pattern: []string{
+			"seti 0 _ q",
+			"addi q 1 t",
+			"muli t #d t",
+			"gtrr t x t",
+			"addr t ip ip",
+			"addi ip 1 ip",
+			"seti @8 _ ip",
+			"addi q 1 q",
+			"seti @0 _ ip",
+			"setr q _ x",
+		},
+		macro: func(start int, b bindings) func(c *CPU) bool {
+			return func(c *CPU) bool {
+				x, d := c.Regs[b["x"]], b["#d"]
+				if x < 0 || d <= 0 {
+					return false
+				}
+				q := x / d
+				c.Regs[b["q"]] = q
+				c.Regs[b["t"]] = 1
+				c.Regs[b["x"]] = q
+				c.Regs[b["ip"]] = start + 9
+				c.IP = start + 10
+				// 7 instructions per iteration that continues, 6 for the one
+				// that exits, plus the initial seti.
+				c.Cycles += 7*q + 7
+				return true
+			}
+		},
+	},
+}
+
+// Optimize looks for well-known idioms in the program and returns macros
+// that replace them, keyed by the index of their first instruction. Assign
+// the result to CPU.Macros to use them.
+func Optimize(p Program) map[int]Macro {
+	macros := make(map[int]Macro)
+	if p.IPReg < 0 {
+		return macros
+	}
+	for start := range p.Statements {
+		for _, id := range idioms {
+			if start+len(id.pattern) > len(p.Statements) {
+				continue
+			}
+			b := bindings{"ip": p.IPReg}
+			if !matchLines(p.Statements[start:], id.pattern, start, b) {
+				continue
+			}
+			macros[start] = Macro{
+				Name:  id.name,
+				Start: start,
+				End:   start + len(id.pattern),
+				Apply: id.macro(start, b),
+			}
+			break
+		}
+	}
+	return macros
+}
+
+var commutative = map[string]bool{
+	"addr": true, "mulr": true, "banr": true, "borr": true, "eqrr": true,
+}
+
+func matchLines(stmts []Statement, pattern []string, start int, b bindings) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	fields := strings.Fields(pattern[0])
+	s := stmts[0]
+	if s.Mnemonic != fields[0] {
+		return false
+	}
+	orders := [][3]int{{0, 1, 2}}
+	if commutative[s.Mnemonic] {
+		orders = append(orders, [3]int{1, 0, 2})
+	}
+	for _, order := range orders {
+		attempt := make(bindings, len(b))
+		for k, v := range b {
+			attempt[k] = v
+		}
+		ok := true
+		for k, idx := range order {
+			if !matchOperand(fields[k+1], s.Operands[idx], start, attempt) {
+				ok = false
+				break
+			}
+		}
+		if ok && matchLines(stmts[1:], pattern[1:], start, attempt) {
+			for k, v := range attempt {
+				b[k] = v
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func matchOperand(tok string, v, start int, b bindings) bool {
+	switch {
+	case tok == "_":
+		return true
+	case tok[0] == '@':
+		k, _ := strconv.Atoi(tok[1:])
+		return v == start+k
+	case tok[0] >= '0' && tok[0] <= '9':
+		n, _ := strconv.Atoi(tok)
+		return v == n
+	}
+	if bound, ok := b[tok]; ok {
+		return bound == v
+	}
+	if tok[0] != '#' {
+		// Distinct register variables must name distinct registers.
+		for k, bound := range b {
+			if k[0] != '#' && bound == v {
+				return false
+			}
+		}
+	}
+	b[tok] = v
+	return true
+}
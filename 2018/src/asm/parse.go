@@ -0,0 +1,156 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Statement is a single instruction of a parsed program, along with where it
+// came from in the source text.
+type Statement struct {
+	Instruction
+	Mnemonic string
+	Comment  string
+	Line     int
+}
+
+func (s Statement) String() string {
+	return fmt.Sprintf("%s %d %d %d", s.Mnemonic, s.Operands[0], s.Operands[1], s.Operands[2])
+}
+
+// Program is a parsed ElfCode listing. IPReg is the register bound to the
+// instruction pointer by an "#ip N" directive, or -1 if there was none.
+type Program struct {
+	IPReg      int
+	Statements []Statement
+}
+
+// Instructions returns just the executable part of the program.
+func (p Program) Instructions() []Instruction {
+	ret := make([]Instruction, len(p.Statements))
+	for i, s := range p.Statements {
+		ret[i] = s.Instruction
+	}
+	return ret
+}
+
+// Check verifies that the program only addresses registers below n.
+func (p Program) Check(n int) error {
+	if p.IPReg >= n {
+		return fmt.Errorf("instruction pointer register %d is out of range", p.IPReg)
+	}
+	for _, s := range p.Statements {
+		if _, err := newStatement(s.Mnemonic, s.Operands, n); err != nil {
+			return &ParseError{s.Line, err.Error()}
+		}
+	}
+	return nil
+}
+
+// ParseError reports a problem with a specific line of a program.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse reads a program of the form
+//
+//	#ip 5
+//	addi 5 16 5 ; comment
+//	...
+//
+// Anything following a ';' is kept as the comment of that line, and blank or
+// comment-only lines are skipped. Register operands must be below
+// DefaultRegisters.
+func Parse(in io.Reader) (Program, error) {
+	return ParseWidth(in, DefaultRegisters)
+}
+
+// ParseWidth is like Parse for a machine with the given number of registers.
+func ParseWidth(in io.Reader, registers int) (Program, error) {
+	p := Program{IPReg: -1}
+	scanner := bufio.NewScanner(in)
+	for ln := 1; scanner.Scan(); ln++ {
+		l := scanner.Text()
+		comment := ""
+		if idx := strings.Index(l, ";"); idx >= 0 {
+			comment = strings.TrimSpace(l[idx+1:])
+			l = l[:idx]
+		}
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "#ip" {
+			if p.IPReg != -1 {
+				return p, &ParseError{ln, "duplicate #ip directive"}
+			}
+			if len(p.Statements) != 0 {
+				return p, &ParseError{ln, "#ip directive must precede all instructions"}
+			}
+			if len(fields) != 2 {
+				return p, &ParseError{ln, fmt.Sprintf("#ip takes 1 operand, got %d", len(fields)-1)}
+			}
+			reg, err := strconv.Atoi(fields[1])
+			if err != nil || reg < 0 || reg >= registers {
+				return p, &ParseError{ln, fmt.Sprintf("invalid instruction pointer register %q", fields[1])}
+			}
+			p.IPReg = reg
+			continue
+		}
+
+		s, err := parseStatement(fields, registers)
+		if err != nil {
+			return p, &ParseError{ln, err.Error()}
+		}
+		s.Comment = comment
+		s.Line = ln
+		p.Statements = append(p.Statements, s)
+	}
+	return p, scanner.Err()
+}
+
+func parseStatement(fields []string, registers int) (Statement, error) {
+	if _, ok := Signatures[fields[0]]; !ok {
+		return Statement{}, fmt.Errorf("unknown op %q", fields[0])
+	}
+	if len(fields) != 4 {
+		return Statement{}, fmt.Errorf("%s takes 3 operands, got %d", fields[0], len(fields)-1)
+	}
+	var operands [3]int
+	for i := 0; i < 3; i++ {
+		v, err := strconv.Atoi(fields[i+1])
+		if err != nil {
+			return Statement{}, fmt.Errorf("operand %d of %s is not a number: %q", i+1, fields[0], fields[i+1])
+		}
+		operands[i] = v
+	}
+	return newStatement(fields[0], operands, registers)
+}
+
+// newStatement builds a statement, checking that the op exists and that its
+// register operands are in range.
+func newStatement(mnemonic string, operands [3]int, registers int) (Statement, error) {
+	var s Statement
+	s.Mnemonic = mnemonic
+	s.F = AllOps[mnemonic]
+	sig, ok := Signatures[mnemonic]
+	if s.F == nil || !ok {
+		return s, fmt.Errorf("unknown op %q", mnemonic)
+	}
+	for i, v := range operands {
+		if sig[i] == Register && (v < 0 || v >= registers) {
+			return s, fmt.Errorf("operand %d of %s is not a valid register: %d", i+1, mnemonic, v)
+		}
+	}
+	s.Operands = operands
+	return s, nil
+}
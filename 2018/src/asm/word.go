@@ -0,0 +1,62 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Word decides how register values behave: Wrap is applied to the result of
+// every arithmetic and bitwise op, and Greater implements the gt ops.
+type Word interface {
+	Wrap(v int) int
+	Greater(a, b int) bool
+	String() string
+}
+
+// Unbounded uses plain Go ints, as the puzzles assume.
+var Unbounded Word = unbounded{}
+
+// Uint64 treats registers as unsigned 64-bit values that wrap around.
+var Uint64 Word = uint64Word{}
+
+// Masked keeps only the low bits of every result.
+func Masked(bits uint) Word {
+	return masked(bits)
+}
+
+// ParseWord understands the names returned by each Word's String method:
+// "unbounded", "uint64" and "maskN" for N bits.
+func ParseWord(s string) (Word, error) {
+	switch s {
+	case "", "unbounded":
+		return Unbounded, nil
+	case "uint64":
+		return Uint64, nil
+	}
+	if strings.HasPrefix(s, "mask") {
+		bits, err := strconv.Atoi(s[len("mask"):])
+		if err == nil && bits > 0 && bits < 63 {
+			return Masked(uint(bits)), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown word semantics %q", s)
+}
+
+type unbounded struct{}
+
+func (unbounded) Wrap(v int) int        { return v }
+func (unbounded) Greater(a, b int) bool { return a > b }
+func (unbounded) String() string        { return "unbounded" }
+
+type uint64Word struct{}
+
+func (uint64Word) Wrap(v int) int        { return v }
+func (uint64Word) Greater(a, b int) bool { return uint64(a) > uint64(b) }
+func (uint64Word) String() string        { return "uint64" }
+
+type masked uint
+
+func (m masked) Wrap(v int) int        { return v & (1<<uint(m) - 1) }
+func (m masked) Greater(a, b int) bool { return a > b }
+func (m masked) String() string        { return fmt.Sprintf("mask%d", uint(m)) }